@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFileNames are the names of the project configuration file, read at
+// the module root.
+var configFileNames = []string{".genconstructor.yaml", ".genconstructor.yml"}
+
+// config is the project configuration, set by the configuration file and
+// taking the place of the flags and options not given.
+type config struct {
+	// Suffix is the suffix of the generated file names instead of
+	// _constructor_gen.go.
+	Suffix string
+	// Exclude are the patterns of the directories skipped by ./....
+	Exclude []string
+	// Template is the path of the constructor template, relative to the
+	// configuration file.
+	Template    string
+	Initialisms []string
+	// Marker are the options every marker takes, e.g. "-p -g".
+	Marker string
+}
+
+// loadConfig reads the configuration file at the root of the module of dir,
+// if any, and returns it with the path it is read from.
+func loadConfig(dir string) (config, string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return config{}, "", err
+	}
+	for modDir := abs; ; modDir = filepath.Dir(modDir) {
+		if _, err := os.Stat(filepath.Join(modDir, "go.mod")); err == nil {
+			for _, name := range configFileNames {
+				path := filepath.Join(modDir, name)
+				data, err := ioutil.ReadFile(path)
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return config{}, "", err
+				}
+				cfg, err := parseConfig(data, path)
+				if err != nil {
+					return config{}, "", err
+				}
+				if cfg.Template != "" && !filepath.IsAbs(cfg.Template) {
+					cfg.Template = filepath.Join(modDir, filepath.FromSlash(cfg.Template))
+				}
+				return cfg, path, nil
+			}
+			return config{}, "", nil
+		} else if !os.IsNotExist(err) {
+			return config{}, "", err
+		}
+		if filepath.Dir(modDir) == modDir {
+			return config{}, "", nil
+		}
+	}
+}
+
+// parseConfig parses the configuration file named filename, a subset of
+// YAML: a mapping of keys to scalars and to lists, either block lists of
+// "- item" lines or flow lists such as [a, b], with # comments.
+func parseConfig(data []byte, filename string) (config, error) {
+	var cfg config
+	lists := map[string]*[]string{
+		"exclude":     &cfg.Exclude,
+		"initialisms": &cfg.Initialisms,
+	}
+	scalars := map[string]*string{
+		"suffix":   &cfg.Suffix,
+		"template": &cfg.Template,
+		"marker":   &cfg.Marker,
+	}
+	// list is the block list being read, if any
+	var list *[]string
+	for i, line := range strings.Split(string(data), "\n") {
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", filename, i+1, fmt.Sprintf(format, args...))
+		}
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if list == nil {
+				return cfg, errorf("list item outside of a list")
+			}
+			v, err := unquoteScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return cfg, errorf("%v", err)
+			}
+			*list = append(*list, v)
+			continue
+		}
+		if line != trimmed {
+			return cfg, errorf("unexpected indentation")
+		}
+		list = nil
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return cfg, errorf("want key: value")
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if dst, ok := scalars[key]; ok {
+			v, err := unquoteScalar(value)
+			if err != nil {
+				return cfg, errorf("%v", err)
+			}
+			*dst = v
+			continue
+		}
+		dst, ok := lists[key]
+		if !ok {
+			return cfg, errorf("unknown key %q", key)
+		}
+		*dst = nil
+		switch {
+		case value == "":
+			list = dst
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, item := range splitFlowList(value[1 : len(value)-1]) {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				v, err := unquoteScalar(item)
+				if err != nil {
+					return cfg, errorf("%v", err)
+				}
+				*dst = append(*dst, v)
+			}
+		default:
+			return cfg, errorf("%s needs a list", key)
+		}
+	}
+	return cfg, nil
+}
+
+// stripComment returns line without its comment, which starts with a # at
+// the start of the line or after a space, outside of quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			// the escaped character does not end the string
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitFlowList returns the items of the flow list [s], separated by commas
+// outside of quotes.
+func splitFlowList(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// unquoteScalar returns the value of the scalar s, either plain or quoted.
+func unquoteScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
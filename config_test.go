@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+		want config
+	}{
+		{
+			name: "scalars",
+			data: "suffix: _ctor_gen.go\ntemplate: 'ctor.tmpl'\nmarker: \"-p -g\"\n",
+			want: config{Suffix: "_ctor_gen.go", Template: "ctor.tmpl", Marker: "-p -g"},
+		},
+		{
+			name: "comments",
+			data: "# the marker\nmarker: -p # pointers\nsuffix: a#b.go\n",
+			want: config{Marker: "-p", Suffix: "a#b.go"},
+		},
+		{
+			name: "# inside quotes",
+			data: "marker: \"-p #1\" # pointers\ntemplate: 'a #b' \nsuffix: \"a\\\" #b\"\n",
+			want: config{Marker: "-p #1", Template: "a #b", Suffix: "a\" #b"},
+		},
+		{
+			name: "escaped single quote",
+			data: "marker: 'it''s'\n",
+			want: config{Marker: "it's"},
+		},
+		{
+			name: "block list",
+			data: "exclude:\n  - mocks # generated\n  - 'internal/x'\n\ninitialisms:\n- ID\n",
+			want: config{Exclude: []string{"mocks", "internal/x"}, Initialisms: []string{"ID"}},
+		},
+		{
+			name: "flow list",
+			data: "exclude: [mocks, \"a,b\", 'c, d',]\ninitialisms: []\n",
+			want: config{Exclude: []string{"mocks", "a,b", "c, d"}},
+		},
+		{
+			name: "list replaced",
+			data: "exclude: [a]\nexclude: [b]\n",
+			want: config{Exclude: []string{"b"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfig([]byte(tt.data), ".genconstructor.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "unknown key", data: "suffix: a.go\nprefix: b\n", want: `.genconstructor.yaml:2: unknown key "prefix"`},
+		{name: "no value", data: "suffix\n", want: ".genconstructor.yaml:1: want key: value"},
+		{name: "item outside of a list", data: "- mocks\n", want: ".genconstructor.yaml:1: list item outside of a list"},
+		{name: "item after a scalar", data: "suffix: a.go\n  - mocks\n", want: ".genconstructor.yaml:2: list item outside of a list"},
+		{name: "indentation", data: "exclude:\n  suffix: a.go\n", want: ".genconstructor.yaml:2: unexpected indentation"},
+		{name: "scalar list", data: "exclude: mocks\n", want: ".genconstructor.yaml:1: exclude needs a list"},
+		{name: "unterminated single quote", data: "marker: 'a\n", want: ".genconstructor.yaml:1: unterminated string 'a"},
+		{name: "unterminated double quote", data: "marker: \"a\n", want: ".genconstructor.yaml:1: invalid syntax"},
+		{name: "unterminated item", data: "exclude: ['a]\n", want: ".genconstructor.yaml:1: unterminated string 'a"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseConfig([]byte(tt.data), ".genconstructor.yaml"); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
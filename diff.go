@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around the changes of a
+// hunk.
+const diffContext = 3
+
+// diffFiles writes into w a unified diff from each file of generated to the
+// contents generated for it, or to nothing when they are nil, and returns an
+// outOfDateError listing the files which differ.
+func diffFiles(w io.Writer, generated map[string]*bytes.Buffer) error {
+	paths := make([]string, 0, len(generated))
+	for path := range generated {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var changed []string
+	for _, path := range paths {
+		old, err := ioutil.ReadFile(path)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		b := generated[path]
+		if b == nil && !exists || b != nil && exists && bytes.Equal(old, b.Bytes()) {
+			continue
+		}
+		changed = append(changed, path)
+		oldName, newName := "a/"+path, "b/"+path
+		var contents []byte
+		switch {
+		case !exists:
+			oldName = "/dev/null"
+		case b == nil:
+			newName = "/dev/null"
+		}
+		if b != nil {
+			contents = b.Bytes()
+		}
+		fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName)
+		if err := writeHunks(w, diffLines(splitLines(old), splitLines(contents))); err != nil {
+			return err
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return outOfDateError{paths: changed}
+}
+
+// splitLines returns the lines of data, each with its newline but the last
+// one if data does not end with a newline.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineEdit is a line of a diff: kept (' '), deleted ('-') or inserted
+// ('+').
+type lineEdit struct {
+	op   byte
+	line string
+}
+
+// diffLines returns the shortest edit script from a to b, by the Myers
+// algorithm.
+func diffLines(a, b []string) []lineEdit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] is v before the paths of d edits are extended
+	var trace [][]int
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var edits []lineEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			edits = append(edits, lineEdit{op: ' ', line: a[x-1]})
+			x, y = x-1, y-1
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			edits = append(edits, lineEdit{op: '+', line: b[y-1]})
+			y--
+		} else {
+			edits = append(edits, lineEdit{op: '-', line: a[x-1]})
+			x--
+		}
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// writeHunks writes edits into w as the hunks of a unified diff, the changes
+// closer than twice diffContext lines sharing a hunk.
+func writeHunks(w io.Writer, edits []lineEdit) error {
+	// aLines[i] and bLines[i] are the lines of each side before edits[i]
+	aLines := make([]int, len(edits)+1)
+	bLines := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if e.op != '+' {
+			aLines[i+1]++
+		}
+		if e.op != '-' {
+			bLines[i+1]++
+		}
+	}
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(edits) && j-end <= 2*diffContext; j++ {
+			if edits[j].op != ' ' {
+				end = j
+			}
+		}
+		stop := end + diffContext + 1
+		if stop > len(edits) {
+			stop = len(edits)
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n",
+			hunkRange(aLines[start], aLines[stop]-aLines[start]),
+			hunkRange(bLines[start], bLines[stop]-bLines[start]))
+		for _, e := range edits[start:stop] {
+			line := e.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			if _, err := fmt.Fprintf(w, "%c%s", e.op, line); err != nil {
+				return err
+			}
+		}
+		i = stop
+	}
+	return nil
+}
+
+// hunkRange returns the range of a side of a hunk of count lines after the
+// first before ones.
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprint(before + 1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
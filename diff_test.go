@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriteHunks(t *testing.T) {
+	// numbered returns the lines 1 to 20, with the given ones changed
+	numbered := func(changed ...int) []string {
+		var lines []string
+		for i := 1; i <= 20; i++ {
+			line := strconv.Itoa(i)
+			for _, c := range changed {
+				if c == i {
+					line += "x"
+				}
+			}
+			lines = append(lines, line+"\n")
+		}
+		return lines
+	}
+	for _, tt := range []struct {
+		name string
+		a, b []string
+		want string
+	}{
+		{
+			name: "changes sharing their context",
+			a:    numbered(),
+			b:    numbered(5, 9),
+			want: `@@ -2,11 +2,11 @@
+ 2
+ 3
+ 4
+-5
++5x
+ 6
+ 7
+ 8
+-9
++9x
+ 10
+ 11
+ 12
+`,
+		},
+		{
+			name: "changes apart",
+			a:    numbered(),
+			b:    numbered(5, 15),
+			want: `@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++5x
+ 6
+ 7
+ 8
+@@ -12,7 +12,7 @@
+ 12
+ 13
+ 14
+-15
++15x
+ 16
+ 17
+ 18
+`,
+		},
+		{
+			name: "first and last lines",
+			a:    []string{"a\n", "b\n", "c"},
+			b:    []string{"A\n", "b\n", "C\n"},
+			want: `@@ -1,3 +1,3 @@
+-a
++A
+ b
+-c
+\ No newline at end of file
++C
+`,
+		},
+		{
+			name: "from nothing",
+			b:    []string{"a\n", "b\n"},
+			want: `@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+		{
+			name: "unchanged",
+			a:    numbered(),
+			b:    numbered(),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := writeHunks(&b, diffLines(tt.a, tt.b)); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range map[string]string{
+		"same.go":  "package a\n",
+		"stale.go": "package a\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing, same, stale := filepath.Join(dir, "missing.go"), filepath.Join(dir, "same.go"), filepath.Join(dir, "stale.go")
+
+	var out bytes.Buffer
+	err = diffFiles(&out, map[string]*bytes.Buffer{
+		missing:                       bytes.NewBufferString("package a\n"),
+		same:                          bytes.NewBufferString("package a\n"),
+		stale:                         nil,
+		filepath.Join(dir, "gone.go"): nil,
+	})
+	want := `--- /dev/null
++++ b/` + missing + `
+@@ -0,0 +1 @@
++package a
+--- a/` + stale + `
++++ /dev/null
+@@ -1 +0,0 @@
+-package a
+`
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	var outOfDate outOfDateError
+	if !errors.As(err, &outOfDate) {
+		t.Fatalf("got %v, want an outOfDateError", err)
+	}
+	if want := []string{missing, stale}; !reflect.DeepEqual(outOfDate.paths, want) {
+		t.Errorf("got paths %q, want %q", outOfDate.paths, want)
+	}
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	if code := exitCode(err); code != exitOutOfDate {
+		t.Errorf("got exit code %d, want %d", code, exitOutOfDate)
+	}
+
+	out.Reset()
+	if err := diffFiles(&out, map[string]*bytes.Buffer{same: bytes.NewBufferString("package a\n")}); err != nil || out.Len() > 0 {
+		t.Errorf("got %v and:\n%s\nwant no diff", err, out.String())
+	}
+}
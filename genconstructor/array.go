@@ -0,0 +1,88 @@
+package genconstructor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+)
+
+// validateArrayConstValue checks that a const value given for a fixed-size
+// array field is an array literal of the same length.
+// Values that are not composite literals (calls, variables, ...) and arrays
+// whose length is not an integer literal are left to the compiler.
+func validateArrayConstValue(fieldType ast.Expr, constValue string) error {
+	arrayType, ok := fieldType.(*ast.ArrayType)
+	if !ok || arrayType.Len == nil {
+		return nil
+	}
+	want, ok := intLiteral(arrayType.Len)
+	if !ok {
+		return nil
+	}
+
+	expr, err := parser.ParseExpr(constValue)
+	if err != nil {
+		return nil
+	}
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil
+	}
+	litType, ok := lit.Type.(*ast.ArrayType)
+	if !ok || litType.Len == nil {
+		return fmt.Errorf("const value %q is not an array literal of length %d", constValue, want)
+	}
+
+	got, ok := compositeLitLen(lit)
+	if !ok {
+		return nil
+	}
+	if _, isEllipsis := litType.Len.(*ast.Ellipsis); !isEllipsis {
+		declared, ok := intLiteral(litType.Len)
+		if !ok {
+			return nil
+		}
+		if declared < got {
+			return nil // out of bounds index; the compiler reports it better
+		}
+		got = declared
+	}
+	if got != want {
+		return fmt.Errorf("const value %q has length %d, want %d", constValue, got, want)
+	}
+	return nil
+}
+
+// compositeLitLen returns the length implied by the elements of lit,
+// taking integer-literal keys into account.
+func compositeLitLen(lit *ast.CompositeLit) (int64, bool) {
+	var n, next int64
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			index, ok := intLiteral(kv.Key)
+			if !ok {
+				return 0, false
+			}
+			next = index
+		}
+		next++
+		if next > n {
+			n = next
+		}
+	}
+	return n, true
+}
+
+func intLiteral(expr ast.Expr) (int64, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(lit.Value, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,59 @@
+package genconstructor_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRun_arrayConstValue(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		field   string
+		wantErr string
+	}{
+		{
+			name:  "exact length",
+			field: "buf [3]int `required:\"[3]int{1, 2, 3}\"`",
+		},
+		{
+			name:  "ellipsis",
+			field: "buf [3]int `required:\"[...]int{1, 2, 3}\"`",
+		},
+		{
+			name:  "keyed elements",
+			field: "buf [3]int `required:\"[...]int{2: 1}\"`",
+		},
+		{
+			name:  "not a literal",
+			field: "buf [3]int `required:\"defaultBuf()\"`",
+		},
+		{
+			name:    "short ellipsis",
+			field:   "buf [3]int `required:\"[...]int{1, 2}\"`",
+			wantErr: "a.go:5:2: field buf: const value \"[...]int{1, 2}\" has length 2, want 3",
+		},
+		{
+			name:    "declared length",
+			field:   "buf [3]int `required:\"[4]int{}\"`",
+			wantErr: "has length 4, want 3",
+		},
+		{
+			name:    "slice literal",
+			field:   "buf [3]int `required:\"[]int{1, 2, 3}\"`",
+			wantErr: "is not an array literal of length 3",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generate(t, "package a\n\n//genconstructor\ntype Foo struct {\n\t"+tt.field+"\n}\n")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package genconstructor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"io"
+	"text/template"
+)
+
+// fieldAssertionTest is the name of the test asserting the field counts,
+// and constructorCallTest the one calling the constructors.
+const (
+	fieldAssertionTest  = "TestGenconstructorFieldCounts"
+	constructorCallTest = "TestGenconstructorConstructors"
+)
+
+// WithFieldAssertions makes Run also write a test of each package into the
+// writer newWriter returns, e.g. for a foo_constructor_gen_test.go file,
+// asserting that the marked structs have as many fields as when their
+// constructors were generated:
+//
+//	{reflect.TypeOf((*Foo)(nil)).Elem(), 3},
+//
+// Adding a field then fails the test until the constructor is regenerated.
+// Generic structs are left out, since they cannot be named without type
+// arguments.
+func WithFieldAssertions(newWriter func(pkg *ast.Package) io.Writer) Option {
+	return func(o *option) {
+		o.newAssertionWriter = newWriter
+		o.assertFields = true
+	}
+}
+
+// WithConstructorTests makes Run also write a test of each package into the
+// writer newWriter returns, calling each constructor with the zero values
+// of its parameters:
+//
+//	t.Run("NewFoo", func(t *testing.T) {
+//		defer func() { _ = recover() }()
+//		_ = NewFoo(*new(string), nil)
+//	})
+//
+// The test fails to compile once the parameters of a constructor change
+// until the constructor is regenerated, and runs the generated code; the
+// panics of the checks of the constructor on zero values are recovered.
+// It is written into the same test as WithFieldAssertions, which must be
+// given the same writer, if both are used. Generic structs are left out,
+// and it cannot be used with WithSubpackage, whose package the test of the
+// package of the structs cannot import.
+func WithConstructorTests(newWriter func(pkg *ast.Package) io.Writer) Option {
+	return func(o *option) {
+		o.newAssertionWriter = newWriter
+		o.constructorTests = true
+	}
+}
+
+// constructorCall is the call of a constructor by the constructor test.
+type constructorCall struct {
+	Name string
+	// Args are the zero values of the parameters, and Types their types.
+	Args         []string
+	Types        []string
+	ReturnsError bool
+}
+
+// constructorCall returns the call of the constructor of p with the zero
+// values of its parameters.
+func (p tmplParam) constructorCall() constructorCall {
+	call := constructorCall{Name: p.FuncName, ReturnsError: p.ReturnsError && !p.Pair}
+	for _, f := range p.Params {
+		_, typ := p.param(f)
+		arg := "*new(" + typ + ")"
+		if f.Nilable {
+			arg = "nil"
+		}
+		call.Args = append(call.Args, arg)
+		call.Types = append(call.Types, typ)
+	}
+	return call
+}
+
+// recordCall records the call of the constructor of structName by the
+// constructor test.
+func (c *fieldCollector) recordCall(structName string, call constructorCall) {
+	if c.calls == nil {
+		c.calls = make(map[string]constructorCall)
+	}
+	c.calls[structName] = call
+}
+
+// testImports returns the imports of the test of the package pkgPath,
+// given the imports of its generated file: those of the types of the
+// parameters of calls, and those of the tests.
+func testImports(counts []fieldCount, calls []constructorCall, imports map[string]string, pkgPath string) (string, error) {
+	used := map[string]string{"testing": "testing"}
+	if len(counts) > 0 {
+		used["reflect"] = "reflect"
+	}
+	for _, call := range calls {
+		for _, typ := range call.Types {
+			x, err := parser.ParseExpr(typ)
+			if err != nil {
+				return "", fmt.Errorf("invalid type %q: %v", typ, err)
+			}
+			for name, importPath := range exprImports(x, imports) {
+				used[name] = importPath
+			}
+		}
+	}
+	return fmtImports(used, pkgPath), nil
+}
+
+// fieldCount is the number of fields of a struct asserted by the test.
+type fieldCount struct {
+	StructName string
+	N          int
+}
+
+// numFields returns the number of fields of structType, as
+// reflect.Type.NumField counts them.
+func numFields(structType *ast.StructType) int {
+	n := 0
+	for _, field := range structType.Fields.List {
+		if len(field.Names) == 0 {
+			n++
+		}
+		n += len(field.Names)
+	}
+	return n
+}
+
+// assertionTmpl renders the field count test of a package.
+var assertionTmpl = template.Must(template.New("assertion").Parse(`
+			{{ if .Header }}// Code generated by {{ .GeneratorName }}; DO NOT EDIT.{{ end }}
+
+			{{ .BuildConstraint }}
+
+			package {{ .PackageName }}
+
+			{{ .Imports }}
+			{{- if .Counts }}
+
+			func {{ .TestName }}(t *testing.T) {
+				for _, tt := range []struct {
+					typ  reflect.Type
+					want int
+				}{
+					{{- range .Counts }}
+					{reflect.TypeOf((*{{ .StructName }})(nil)).Elem(), {{ .N }}},
+					{{- end }}
+				} {
+					if got := tt.typ.NumField(); got != tt.want {
+						t.Errorf("%s has %d fields, want %d; regenerate its constructor", tt.typ, got, tt.want)
+					}
+				}
+			}
+			{{- end }}
+			{{- if .Calls }}
+
+			func {{ .CallTestName }}(t *testing.T) {
+				{{- range .Calls }}
+				t.Run("{{ .Name }}", func(t *testing.T) {
+					// the zero values may be rejected by the checks
+					defer func() { _ = recover() }()
+					{{ if .ReturnsError }}_, _ = {{ else }}_ = {{ end }}{{ .Name }}({{ range $i, $a := .Args }}{{ if $i }}, {{ end }}{{ $a }}{{ end }})
+				})
+				{{- end }}
+			}
+			{{- end }}
+		`))
@@ -0,0 +1,125 @@
+package genconstructor
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"path/filepath"
+	"strings"
+)
+
+// parseBuildTag parses a build constraint expression, e.g. "linux && !cgo",
+// or constraint lines of either syntax, e.g. "// +build linux,!cgo".
+// Several legacy lines must all be satisfied.
+func parseBuildTag(tag string) (constraint.Expr, error) {
+	tag = strings.TrimSpace(tag)
+	if !strings.HasPrefix(tag, "//") {
+		return constraint.Parse("//go:build " + tag)
+	}
+	var exprs []constraint.Expr
+	for _, line := range strings.Split(tag, "\n") {
+		x, err := constraint.Parse(strings.TrimSpace(line))
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, x)
+	}
+	return andConstraints(exprs), nil
+}
+
+// fileConstraint returns the build constraint of file: its //go:build line,
+// or else the conjunction of its // +build lines. It is nil when there is
+// none.
+func fileConstraint(file *ast.File) constraint.Expr {
+	var plusBuild []constraint.Expr
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			switch {
+			case constraint.IsGoBuild(c.Text):
+				if x, err := constraint.Parse(c.Text); err == nil {
+					return x
+				}
+			case constraint.IsPlusBuild(c.Text):
+				if x, err := constraint.Parse(c.Text); err == nil {
+					plusBuild = append(plusBuild, x)
+				}
+			}
+		}
+	}
+	return andConstraints(plusBuild)
+}
+
+// andConstraints returns the conjunction of exprs, leaving out repeated
+// ones, or nil if there is none.
+func andConstraints(exprs []constraint.Expr) constraint.Expr {
+	var and constraint.Expr
+	seen := make(map[string]bool, len(exprs))
+	for _, x := range exprs {
+		if x == nil || seen[x.String()] {
+			continue
+		}
+		seen[x.String()] = true
+		if and == nil {
+			and = x
+			continue
+		}
+		and = &constraint.AndExpr{X: and, Y: x}
+	}
+	return and
+}
+
+// buildConstraintLines returns the //go:build line for the build constraint
+// expr, followed by the equivalent legacy // +build lines as gofmt writes
+// them.
+func buildConstraintLines(expr constraint.Expr) (string, error) {
+	plusBuild, err := constraint.PlusBuildLines(expr)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append([]string{"//go:build " + expr.String()}, plusBuild...), "\n"), nil
+}
+
+// fileNameConstraint returns the build constraint implied by the name of a
+// file, such as linux for foo_linux.go or linux && amd64 for
+// foo_linux_amd64.go, following go/build. It is nil when there is none.
+func fileNameConstraint(filename string) constraint.Expr {
+	name := strings.TrimSuffix(filepath.Base(filename), ".go")
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return nil
+	}
+	l := strings.Split(name[i:], "_")
+	if n := len(l); n > 0 && l[n-1] == "test" {
+		l = l[:n-1]
+	}
+	n := len(l)
+	switch {
+	case n >= 2 && knownOS[l[n-2]] && knownArch[l[n-1]]:
+		return &constraint.AndExpr{X: &constraint.TagExpr{Tag: l[n-2]}, Y: &constraint.TagExpr{Tag: l[n-1]}}
+	case n >= 1 && (knownOS[l[n-1]] || knownArch[l[n-1]]):
+		return &constraint.TagExpr{Tag: l[n-1]}
+	}
+	return nil
+}
+
+// knownOS and knownArch are the GOOS and GOARCH values go/build recognizes
+// in file names.
+var (
+	knownOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true,
+		"freebsd": true, "hurd": true, "illumos": true, "ios": true,
+		"js": true, "linux": true, "nacl": true, "netbsd": true,
+		"openbsd": true, "plan9": true, "solaris": true, "wasip1": true,
+		"windows": true, "zos": true,
+	}
+	knownArch = map[string]bool{
+		"386": true, "amd64": true, "amd64p32": true, "arm": true,
+		"armbe": true, "arm64": true, "arm64be": true, "loong64": true,
+		"mips": true, "mipsle": true, "mips64": true, "mips64le": true,
+		"mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true,
+		"ppc64le": true, "riscv": true, "riscv64": true, "s390": true,
+		"s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+	}
+)
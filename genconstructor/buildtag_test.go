@@ -0,0 +1,299 @@
+package genconstructor_test
+
+import (
+	"bytes"
+	"go/ast"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/GuiltyMorishita/go-genconstructor/genconstructor"
+)
+
+func TestRun_withBuildTag(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithBuildTag("!genconstructor_off && (linux || darwin)"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by go-genconstructor; DO NOT EDIT.
+
+//go:build !genconstructor_off && (linux || darwin)
+// +build !genconstructor_off
+// +build linux darwin
+
+package a
+`
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("got:\n%s\nwant prefix:\n%s", got, want)
+	}
+
+	if _, err := generate(t, src, genconstructor.WithBuildTag("linux &&")); err == nil {
+		t.Error("want error for invalid build tag")
+	}
+}
+
+func TestRun_legacyBuildTag(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithBuildTag("// +build linux,amd64 darwin\n// +build !genconstructor_off"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `//go:build ((linux && amd64) || darwin) && !genconstructor_off
+// +build linux,amd64 darwin
+// +build !genconstructor_off
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRun_fileBuildConstraint(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		opts []genconstructor.Option
+		want string
+	}{
+		{
+			name: "go:build",
+			src: `//go:build linux || darwin
+
+package a
+`,
+			want: `//go:build linux || darwin
+// +build linux darwin
+`,
+		},
+		{
+			name: "legacy +build",
+			src: `// +build linux darwin
+// +build !cgo
+
+package a
+`,
+			want: `//go:build (linux || darwin) && !cgo
+// +build linux darwin
+// +build !cgo
+`,
+		},
+		{
+			name: "with build tag",
+			src: `//go:build linux
+
+package a
+`,
+			opts: []genconstructor.Option{genconstructor.WithBuildTag("!genconstructor_off")},
+			want: `//go:build !genconstructor_off && linux
+// +build !genconstructor_off,linux
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src+`
+//genconstructor
+type Foo struct {
+	id string `+"`required:\"\"`"+`
+}
+`, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_fileNameConstraint(t *testing.T) {
+	got, err := generateFiles(t, map[string]string{
+		"foo_linux.go": `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `//go:build linux
+// +build linux
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRun_constraintFiles(t *testing.T) {
+	files := map[string]string{
+		"foo_linux.go": `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+	fd int    ` + "`required:\"\"`" + `
+}
+`,
+		"foo_windows.go": `//go:build !arm
+
+package a
+
+//genconstructor
+type Foo struct {
+	id     string  ` + "`required:\"\"`" + `
+	handle uintptr ` + "`required:\"\"`" + `
+}
+`,
+		"bar.go": `package a
+
+//genconstructor
+type Bar struct {
+	name string ` + "`required:\"\"`" + `
+}
+`,
+	}
+
+	split := make(map[string]*bytes.Buffer)
+	got, err := generateFiles(t, files, genconstructor.WithConstraintFiles(func(pkg *ast.Package, filename string) io.Writer {
+		b := new(bytes.Buffer)
+		split[filepath.Base(filename)] = b
+		return b
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "func NewBar(") || strings.Contains(got, "func NewFoo(") || strings.Contains(got, "//go:build") {
+		t.Errorf("got:\n%s\nwant NewBar only, without constraint", got)
+	}
+	for name, want := range map[string][]string{
+		"foo_linux.go":   {"//go:build linux\n", "fd int,"},
+		"foo_windows.go": {"//go:build !arm && windows\n", "handle uintptr,"},
+	} {
+		b, ok := split[name]
+		if !ok {
+			t.Errorf("%s: not written", name)
+			continue
+		}
+		for _, w := range want {
+			if !strings.Contains(b.String(), w) {
+				t.Errorf("%s: got:\n%s\nwant:\n%s", name, b, w)
+			}
+		}
+	}
+
+	// without WithConstraintFiles, the constructors of Foo collide
+	if _, err := generateFiles(t, files); err == nil || !strings.Contains(err.Error(), "WithConstraintFiles") {
+		t.Errorf("got %v, want error suggesting WithConstraintFiles", err)
+	}
+}
+
+func TestRun_staleConstraintFiles(t *testing.T) {
+	linux := `package a
+
+//genconstructor
+type Foo struct {
+	fd int ` + "`required:\"\"`" + `
+}
+`
+	windows := `package a
+
+//genconstructor
+type Foo struct {
+	handle uintptr ` + "`required:\"\"`" + `
+}
+`
+	bar := `package a
+
+//genconstructor
+type Bar struct {
+	name string ` + "`required:\"\"`" + `
+}
+`
+	for _, tt := range []struct {
+		name  string
+		files map[string]string
+		opts  []genconstructor.Option
+		// written is nil if remove is not called
+		written      []string
+		stalePackage bool
+	}{
+		{
+			name:    "written apart",
+			files:   map[string]string{"foo_linux.go": linux, "bar.go": bar},
+			written: []string{"foo_linux.go"},
+		},
+		{
+			name:    "no longer written apart",
+			files:   map[string]string{"foo.go": linux, "bar.go": bar},
+			written: []string{},
+		},
+		{
+			name:         "every constructor written apart",
+			files:        map[string]string{"foo_linux.go": linux, "foo_windows.go": windows},
+			written:      []string{"foo_linux.go", "foo_windows.go"},
+			stalePackage: true,
+		},
+		{
+			name:    "no marked structs",
+			files:   map[string]string{"a.go": "package a\n"},
+			written: []string{},
+			// the package has no generated file either
+			stalePackage: true,
+		},
+		{
+			name:  "given files",
+			files: map[string]string{"foo_linux.go": linux, "bar.go": bar},
+			opts:  []genconstructor.Option{genconstructor.WithFiles("foo_linux.go")},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var written []string
+			stalePackage := false
+			opts := append(tt.opts,
+				genconstructor.WithConstraintFiles(func(pkg *ast.Package, filename string) io.Writer {
+					return ioutil.Discard
+				}),
+				genconstructor.WithStaleConstraintFiles(func(pkg *ast.Package, filenames []string) error {
+					written = []string{}
+					for _, filename := range filenames {
+						written = append(written, filepath.Base(filename))
+					}
+					return nil
+				}),
+				genconstructor.WithStaleOutput(func(pkg *ast.Package) error {
+					stalePackage = true
+					return nil
+				}),
+			)
+			if _, err := generateFiles(t, tt.files, opts...); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(written)
+			if !reflect.DeepEqual(written, tt.written) {
+				t.Errorf("written = %q, want %q", written, tt.written)
+			}
+			if stalePackage != tt.stalePackage {
+				t.Errorf("stale package = %v, want %v", stalePackage, tt.stalePackage)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package genconstructor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cache records a hash of the Go files of each directory Run generated for,
+// including the generated files, so that a directory whose files are
+// unchanged since is skipped without being parsed. The files written into
+// other directories, such as those of WithSubpackage, are not hashed.
+type Cache struct {
+	path string
+	// fingerprint is hashed with the files, so that the entries of a run
+	// with other options or another version of the generator do not match.
+	fingerprint string
+
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+// OpenCache returns the cache stored in the file at path, or an empty one
+// if there is no such file. fingerprint identifies what the output depends
+// on besides the files read, e.g. the options and the version of the
+// generator; the entries stored with another fingerprint do not match. An
+// empty path keeps the cache in memory only.
+func OpenCache(path, fingerprint string) (*Cache, error) {
+	c := &Cache{path: path, fingerprint: fingerprint, hashes: make(map[string]string)}
+	if path == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.hashes); err != nil {
+		// a corrupt cache is started over
+		c.hashes = make(map[string]string)
+	}
+	return c, nil
+}
+
+// Save writes the cache into its file, if it has one.
+func (c *Cache) Save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.hashes, "", "\t")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// WithCache makes Run skip the directories whose files have not changed
+// since the run recording them in c, and record the directories it
+// generates for when it succeeds. It cannot be used with WithManifest,
+// which needs the constructors of every package.
+func WithCache(c *Cache) Option {
+	return func(o *option) {
+		o.cache = c
+	}
+}
+
+// unchanged reports whether the files of dir hash to hash as recorded.
+func (c *Cache) unchanged(dir, hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashes[cacheKey(dir)] == hash
+}
+
+func (c *Cache) record(dir, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hashes[cacheKey(dir)] = hash
+}
+
+func cacheKey(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(dir)
+}
+
+// dirHash returns the hash of the fingerprint of c and of the names and
+// contents of the Go files of dir fileFilter accepts, if set.
+func (c *Cache) dirHash(dir string, fileFilter func(finfo os.FileInfo) bool) (string, error) {
+	finfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(finfos, func(i, j int) bool { return finfos[i].Name() < finfos[j].Name() })
+	h := sha256.New()
+	io.WriteString(h, c.fingerprint+"\x00")
+	for _, finfo := range finfos {
+		if finfo.IsDir() || !strings.HasSuffix(finfo.Name(), ".go") || fileFilter != nil && !fileFilter(finfo) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, finfo.Name()))
+		if err != nil {
+			return "", err
+		}
+		io.WriteString(h, finfo.Name()+"\x00")
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,194 @@
+package genconstructor
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// DI frameworks the constructors of a package can be registered with.
+const (
+	DIFx   = "fx"
+	DIWire = "wire"
+	DIDo   = "do"
+)
+
+// diFramework is how the constructors of a package are registered with a
+// dependency injection framework.
+type diFramework struct {
+	// varName is the package-level variable holding the registration, or
+	// the function registering the providers with do.
+	varName    string
+	pkgName    string
+	importPath string
+}
+
+var diFrameworks = map[string]diFramework{
+	DIFx:   {varName: "Module", pkgName: "fx", importPath: "go.uber.org/fx"},
+	DIWire: {varName: "ProviderSet", pkgName: "wire", importPath: "github.com/google/wire"},
+	DIDo:   {varName: "Register", pkgName: "do", importPath: "github.com/samber/do"},
+}
+
+// WithDI makes the generated file of each package also register its
+// constructors with the dependency injection framework di, DIFx, DIWire or
+// DIDo:
+//
+//	var Module = fx.Options(
+//		fx.Provide(NewFoo),
+//	)
+//
+//	var ProviderSet = wire.NewSet(
+//		NewFoo,
+//	)
+//
+//	func Register(injector *do.Injector) {
+//		do.Provide(injector, ProvideFoo)
+//	}
+//
+// With do, each constructor gets a provider, ProvideFoo(injector
+// *do.Injector) (Foo, error), invoking its parameters from the injector by
+// type.
+// With fx, the constructors returning an interface (-return, -as, -s and
+// -e) are annotated as providing it, fx.Annotate(NewFoo, fx.As(new(Foo))).
+// The constructors of the factories of -factory are registered as well, with
+// a provider of their own with do, ProvideFooFactory.
+// Constructors of generic structs cannot be provided without type arguments
+// and are left out.
+func WithDI(di string) Option {
+	return func(o *option) {
+		o.di = di
+	}
+}
+
+// provider is a constructor registered with a DI framework.
+type provider struct {
+	constructor string
+	// iface is the interface the constructor returns the struct as, if it
+	// does.
+	iface string
+}
+
+// decl returns the declaration of the variable registering providers.
+func (f diFramework) decl(providers []provider) string {
+	b := new(bytes.Buffer)
+	switch f.pkgName {
+	case "fx":
+		fmt.Fprintf(b, "var %s = fx.Options(\n", f.varName)
+		for _, p := range providers {
+			if p.iface != "" {
+				fmt.Fprintf(b, "\tfx.Provide(fx.Annotate(%s, fx.As(new(%s)))),\n", p.constructor, p.iface)
+				continue
+			}
+			fmt.Fprintf(b, "\tfx.Provide(%s),\n", p.constructor)
+		}
+	case "wire":
+		fmt.Fprintf(b, "var %s = wire.NewSet(\n", f.varName)
+		for _, p := range providers {
+			fmt.Fprintf(b, "\t%s,\n", p.constructor)
+		}
+	case "do":
+		fmt.Fprintf(b, "func %s(injector *do.Injector) {\n", f.varName)
+		for _, p := range providers {
+			fmt.Fprintf(b, "\tdo.Provide(injector, %s)\n", p.constructor)
+		}
+		b.WriteString("}\n")
+		return b.String()
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
+
+// doProvider is the provider of a constructor for do, e.g.
+// ProvideFoo(injector *do.Injector) (Foo, error).
+type doProvider struct {
+	Name string
+	// Injector is the name of the parameter of the provider, injector
+	// unless a parameter of the constructor is named so.
+	Injector string
+	// Invokes are the parameters of the constructor invoked from the
+	// injector.
+	Invokes []doInvoke
+	// Constructor is the constructor called with Args, and ReturnsError
+	// reports whether it returns an error.
+	Constructor  string
+	Args         []string
+	ReturnsError bool
+	// Zero is the struct, or the pointer or interface returned, returned
+	// with an error.
+	Zero string
+	// Result is the type provided if it is not the result of the struct
+	// constructor: the factory of -factory.
+	Result string
+}
+
+type doInvoke struct {
+	Name string
+	Type string
+}
+
+// doProviderName returns the name of the provider for do of the
+// constructor of structName, unexported as the constructor is.
+func (o option) doProviderName(structName string, marker markerOptions) string {
+	if marker.unexported {
+		return "provide" + o.upperCamel(structName)
+	}
+	return "Provide" + o.upperCamel(structName)
+}
+
+// doProvider returns the provider for do of the constructor of p.
+func (p tmplParam) doProvider(name string) (*doProvider, error) {
+	d := &doProvider{Name: name, Constructor: p.FuncName, ReturnsError: p.ReturnsError}
+	if p.Pair {
+		// the error is returned instead of a panic
+		d.Constructor += "E"
+	}
+	var invokes []doInvoke
+	for _, f := range p.Params {
+		name, typ := p.param(f)
+		invokes = append(invokes, doInvoke{Name: name, Type: typ})
+	}
+	if err := d.invoke(invokes); err != nil {
+		return nil, err
+	}
+	d.Zero = p.StructType + p.TypeArgs + "{}"
+	if p.Pointer || p.ReturnType != "" || p.Super || p.Extends {
+		d.Zero = "nil"
+	}
+	return d, nil
+}
+
+// doFactoryProvider returns the provider for do of the constructor of the
+// factory of p, e.g. ProvideFooFactory(injector *do.Injector)
+// (*FooFactory, error), invoking its dependencies.
+func (p tmplParam) doFactoryProvider(name string) (*doProvider, error) {
+	d := &doProvider{Name: name, Constructor: p.Factory.FuncName, Result: "*" + p.Factory.TypeName + p.TypeArgs}
+	var invokes []doInvoke
+	for _, f := range p.Factory.Deps {
+		invokes = append(invokes, doInvoke{Name: f.ParamName, Type: f.Type})
+	}
+	if err := d.invoke(invokes); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// invoke makes d invoke the parameters of its constructor from the
+// injector and pass them on, naming the injector after none of them.
+func (d *doProvider) invoke(invokes []doInvoke) error {
+	d.Injector = "injector"
+	for _, v := range invokes {
+		if v.Name == "err" {
+			return fmt.Errorf("parameter err collides with the error of %s", d.Name)
+		}
+		if v.Name == d.Injector {
+			d.Injector = "i"
+		}
+		d.Invokes = append(d.Invokes, v)
+		d.Args = append(d.Args, v.Name)
+	}
+	for _, v := range invokes {
+		if v.Name == d.Injector {
+			return fmt.Errorf("parameters injector and i collide with the injector of %s", d.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package genconstructor
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	// SeverityError diagnostics prevent the package from being generated.
+	SeverityError Severity = iota
+	// SeverityWarning diagnostics are only reported to the diagnostics sink.
+	SeverityWarning
+	// SeverityInfo diagnostics tell why nothing was generated for a
+	// directory or package, and are only reported to the diagnostics sink.
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	}
+	return "unknown"
+}
+
+// Diagnostic is a problem found at a position of the source.
+type Diagnostic struct {
+	Pos      token.Position
+	Severity Severity
+	Message  string
+}
+
+func newDiagnostic(pos token.Position, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Pos:      pos,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// Diagnostics is the error Run returns when problems were found in the
+// source. Each one is reported, and packages with problems are not
+// generated, but the other packages are.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	msgs := make([]string, 0, len(ds))
+	for _, d := range ds {
+		msgs = append(msgs, d.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// WithDiagnosticsSink makes Run report every diagnostic to sink as it is
+// found, including warnings, which are not part of the returned error.
+func WithDiagnosticsSink(sink func(Diagnostic)) Option {
+	return func(o *option) {
+		o.diagnosticsSink = sink
+	}
+}
@@ -0,0 +1,116 @@
+package genconstructor_test
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/GuiltyMorishita/go-genconstructor/genconstructor"
+)
+
+func TestRun_diagnostics(t *testing.T) {
+	src := `package a
+
+//genconstructor -p -pp
+type Foo struct {
+	a int ` + "`required:\"\" derived:\"1\"`" + `
+}
+
+//genconstructor
+type Bar struct {
+	b [2]int ` + "`required:\"[...]int{1}\"`" + `
+}
+`
+	var reported []genconstructor.Diagnostic
+	out, err := generate(t, src, genconstructor.WithDiagnosticsSink(func(d genconstructor.Diagnostic) {
+		reported = append(reported, d)
+	}))
+
+	var diagnostics genconstructor.Diagnostics
+	if !errors.As(err, &diagnostics) {
+		t.Fatalf("error = %v, want Diagnostics", err)
+	}
+	if len(diagnostics) != 2 {
+		t.Fatalf("got %d diagnostics, want 2: %v", len(diagnostics), diagnostics)
+	}
+	if out != "" {
+		t.Errorf("package with errors was written:\n%s", out)
+	}
+
+	want := []struct {
+		line     int
+		severity genconstructor.Severity
+	}{
+		{3, genconstructor.SeverityWarning},
+		{5, genconstructor.SeverityError},
+		{10, genconstructor.SeverityError},
+	}
+	if len(reported) != len(want) {
+		t.Fatalf("got %d reported diagnostics, want %d: %v", len(reported), len(want), reported)
+	}
+	for i, w := range want {
+		if reported[i].Pos.Line != w.line || reported[i].Severity != w.severity {
+			t.Errorf("reported[%d] = %v (%v), want line %d (%v)", i, reported[i], reported[i].Severity, w.line, w.severity)
+		}
+	}
+}
+
+func TestRun_nothingGenerated(t *testing.T) {
+	withoutTests := genconstructor.WithFileFilter(func(finfo os.FileInfo) bool {
+		return !strings.HasSuffix(finfo.Name(), "_test.go")
+	})
+	for _, tt := range []struct {
+		name  string
+		files map[string]string
+		opts  []genconstructor.Option
+		want  string
+	}{
+		{
+			name:  "no Go files",
+			files: map[string]string{"README.md": "# a\n"},
+			want:  "no Go files",
+		},
+		{
+			name:  "filtered out",
+			files: map[string]string{"a_test.go": "package a\n", "b_test.go": "package a\n"},
+			opts:  []genconstructor.Option{withoutTests},
+			want:  "all 2 Go files are filtered out",
+		},
+		{
+			name:  "no markers",
+			files: map[string]string{"a.go": "package a\n\ntype Foo struct{}\n"},
+			want:  "package a has no marked structs",
+		},
+		{
+			name:  "no markers in the files",
+			files: map[string]string{"a.go": "package a\n", "foo.go": "package a\n\n//genconstructor\ntype Foo struct{}\n"},
+			opts:  []genconstructor.Option{genconstructor.WithFiles("a.go")},
+			want:  "package a has no marked structs in the given files",
+		},
+		{
+			name:  "no markers matching the names",
+			files: map[string]string{"foo.go": "package a\n\n//genconstructor\ntype Foo struct{}\n"},
+			opts:  []genconstructor.Option{genconstructor.WithStructs(regexp.MustCompile("^Bar$"))},
+			want:  "package a has no marked structs matching ^Bar$",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []genconstructor.Diagnostic
+			opts := append(tt.opts, genconstructor.WithDiagnosticsSink(func(d genconstructor.Diagnostic) {
+				reported = append(reported, d)
+			}))
+			out, err := generateFiles(t, tt.files, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != "" {
+				t.Errorf("got:\n%s\nwant nothing generated", out)
+			}
+			if len(reported) != 1 || reported[0].Severity != genconstructor.SeverityInfo || reported[0].Message != tt.want {
+				t.Errorf("reported %v, want info %q", reported, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package genconstructor
+
+import (
+	"fmt"
+)
+
+// factory is the factory of a struct (-factory): FooFactory holds the
+// dependencies of the constructor, e.g. clocks and ID generators, from
+// NewFooFactory, and its Create method passes them to the constructor with
+// the parameters of each call.
+type factory struct {
+	TypeName string
+	FuncName string
+	// Receiver is the name of the receiver of Create, f unless a parameter
+	// is named so.
+	Receiver string
+	// Deps are the parameters held by the factory.
+	Deps []FieldInfo
+	// Params are the declarations of the parameters of Create, and Args
+	// the arguments it passes to the constructor.
+	Params []string
+	Args   []string
+}
+
+// factoryName returns the name of the constructor of the factory of the
+// struct structName, unexported as the constructor of the struct is.
+func (o option) factoryName(structName string, marker markerOptions) string {
+	if marker.unexported {
+		return "new" + o.upperCamel(structName) + "Factory"
+	}
+	return "New" + o.upperCamel(structName) + "Factory"
+}
+
+// factory returns the factory of the struct of p, holding its parameters
+// marked as dependencies.
+func (p tmplParam) factory(funcName string) (*factory, error) {
+	fac := &factory{TypeName: p.StructName + "Factory", FuncName: funcName}
+	names := make(map[string]bool)
+	for _, f := range p.Params {
+		name, typ := p.param(f)
+		if f.Inject {
+			f.ParamName, f.Type = name, typ
+			fac.Deps = append(fac.Deps, f)
+			continue
+		}
+		names[name] = true
+		fac.Params = append(fac.Params, name+" "+typ)
+	}
+	if len(fac.Deps) == 0 {
+		return nil, fmt.Errorf("-factory needs a dependency: a parameter of a func or interface type or tagged inject:\"true\"")
+	}
+	fac.Receiver = "f"
+	if names[fac.Receiver] {
+		fac.Receiver = "factory"
+	}
+	for _, f := range p.Params {
+		name, _ := p.param(f)
+		if f.Inject {
+			name = fac.Receiver + "." + name
+		}
+		fac.Args = append(fac.Args, name)
+	}
+	if p.Options != nil {
+		fac.Params = append(fac.Params, optionsParam+" ..."+p.Options.TypeName+p.TypeArgs)
+		fac.Args = append(fac.Args, optionsParam+"...")
+	}
+	return fac, nil
+}
+
+// declareFactory returns an error if the type of fac is declared by the
+// package or its names are generated for another struct, and records them
+// otherwise.
+func (c *fieldCollector) declareFactory(structName string, fac *factory) error {
+	if decl, ok := c.scope.decls[fac.TypeName]; ok && c.qualifier == "" {
+		return fmt.Errorf("factory %s is already declared at %s", fac.TypeName, c.walker.FileSet.Position(decl.pos))
+	}
+	for _, name := range []string{fac.TypeName, fac.FuncName} {
+		if err := c.declareConstructor(structName, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
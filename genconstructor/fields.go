@@ -0,0 +1,889 @@
+package genconstructor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/GuiltyMorishita/go-genutil/genutil"
+	"github.com/hori-ryota/go-strcase"
+)
+
+// fieldCollector collects the constructor fields of the struct types of a
+// package, resolving the imports they need into importPackages.
+type fieldCollector struct {
+	walker         genutil.AstPkgWalker
+	importPackages map[string]string
+	scope          *pkgScope
+	// requiredKey is the key of the required tag.
+	requiredKey string
+
+	// flatten makes embedded structs of the package built in place from
+	// their own required fields.
+	flatten     bool
+	structTypes map[string]*ast.StructType
+	visiting    map[string]bool
+	// genericStructs are the names of the structs declaring type
+	// parameters.
+	genericStructs map[string]bool
+	// qualifier is the name the package is imported by when the
+	// constructors are generated for another package, if they are.
+	qualifier string
+
+	// getters makes getters generated for the unexported fields not
+	// tagged with getter:"false" (-g).
+	getters bool
+	// accessors reports whether the struct is marked for go-genaccessor as
+	// well, which generates the getters of the fields with a getter tag.
+	accessors bool
+	// copy makes the slice and map parameters copied before they are
+	// assigned, but those tagged with copy:"false" (-copy).
+	copy bool
+	// factory makes the parameters of func and interface types, and those
+	// tagged with inject:"true", the dependencies of the factory of the
+	// struct, but those tagged with inject:"false" (-factory).
+	factory bool
+	// all makes the fields without tags parameters, but the blank ones
+	// and, with flatten, the embedded structs flattened (-all).
+	all bool
+	// proto makes the exported fields of protobuf messages parameters,
+	// leaving out the internals of the protobuf runtime (-proto).
+	proto bool
+	// optionNames are the names of the functional options generated so
+	// far and the structs they are generated for.
+	optionNames map[string]string
+	// initialisms are the words, upper-cased, the generated names spell as
+	// initialisms.
+	initialisms map[string]bool
+	// constructorNames are the names of the constructors generated so far
+	// and the structs they are generated for.
+	constructorNames map[string]string
+	// calls are the calls of the constructors generated so far by the
+	// constructor test, by struct name (WithConstructorTests).
+	calls map[string]constructorCall
+	// resultTypes are the interfaces the constructors generated so far
+	// return their structs as (-return, -as, -s and -e), by struct name.
+	resultTypes map[string]string
+	// importedWalkers are the packages of other directories read to
+	// flatten their structs, by import path.
+	importedWalkers map[string]*genutil.AstPkgWalker
+	// importErr is the conflict of two packages imported by the same name
+	// found by addImport, if any.
+	importErr error
+}
+
+// recordResultType records that the constructor of structName returns the
+// struct as the interface iface.
+func (c *fieldCollector) recordResultType(structName, iface string) {
+	if c.resultTypes == nil {
+		c.resultTypes = make(map[string]string)
+	}
+	c.resultTypes[structName] = iface
+}
+
+// upperCamel is upperCamel spelling the initialisms of c.
+func (c *fieldCollector) upperCamel(s string) string {
+	return upperCamel(s, c.initialisms)
+}
+
+func newFieldCollector(walker genutil.AstPkgWalker, importPackages map[string]string, requiredKey string) *fieldCollector {
+	structTypes := make(map[string]*ast.StructType)
+	genericStructs := make(map[string]bool)
+	for _, spec := range walker.AllStructSpecs() {
+		structTypes[spec.Name.Name] = spec.Type.(*ast.StructType)
+		if spec.TypeParams != nil && len(spec.TypeParams.List) > 0 {
+			genericStructs[spec.Name.Name] = true
+		}
+	}
+	return &fieldCollector{
+		walker:         walker,
+		importPackages: importPackages,
+		scope:          newPkgScope(walker.Pkg),
+		requiredKey:    requiredKey,
+		structTypes:    structTypes,
+		visiting:       make(map[string]bool),
+		genericStructs: genericStructs,
+
+		importedWalkers: make(map[string]*genutil.AstPkgWalker),
+	}
+}
+
+// collect returns the constructor fields of structType named structName and
+// the name of the field tagged with super.
+func (c *fieldCollector) collect(structName string, structType *ast.StructType) ([]FieldInfo, string, error) {
+	c.visiting[structName] = true
+	defer delete(c.visiting, structName)
+
+	walker := c.walker
+
+	// fields and parameters a const value may refer to
+	locals := make(map[string]bool)
+	for _, field := range splitFieldNames(structType.Fields.List) {
+		name := genutil.ParseFieldName(field)
+		locals[name] = true
+		locals[strcase.ToLowerCamel(name)] = true
+	}
+	isLocal := func(name string) bool {
+		return locals[name]
+	}
+
+	var superName string
+	fieldInfos := make([]FieldInfo, 0, len(structType.Fields.List))
+	for _, field := range splitFieldNames(structType.Fields.List) {
+		var tags fieldTags
+		hasTags := false
+		if field.Tag != nil {
+			// the tag literal may be a raw or an interpreted string
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "invalid tag %s: %v", field.Tag.Value, err)
+			}
+			structTag := reflect.StructTag(tag)
+			if c.all && genutil.ParseFieldName(field) != "_" || c.proto && c.isProtoDataField(field) {
+				structTag = impliedParameter(structTag, c.requiredKey)
+			}
+			tags, hasTags, err = parseFieldTags(structTag, c.requiredKey, func(value string) bool {
+				return c.scope.isValue(value, isLocal)
+			})
+			if err != nil {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "%v", err)
+			}
+		}
+		if !hasTags && !tags.ignore && c.proto && c.isProtoDataField(field) {
+			tags, hasTags = fieldTags{kind: KindParameter}, true
+		}
+		if !hasTags {
+			if c.flatten && !tags.ignore && len(field.Names) == 0 {
+				fieldInfo, ok, err := c.collectEmbedded(field)
+				if err != nil {
+					return nil, "", err
+				}
+				if ok {
+					fieldInfos = append(fieldInfos, fieldInfo)
+					continue
+				}
+			}
+			if !c.all || tags.ignore || genutil.ParseFieldName(field) == "_" {
+				continue
+			}
+			tags, hasTags = fieldTags{kind: KindParameter}, true
+		}
+
+		fieldName := genutil.ParseFieldName(field)
+		typ, err := printExpr(field.Type)
+		if err != nil {
+			return nil, "", err
+		}
+
+		fieldInfo := FieldInfo{
+			Type:      typ,
+			Name:      fieldName,
+			Kind:      tags.kind,
+			ParamName: strcase.ToLowerCamel(fieldName),
+			Order:     tags.order,
+			pos:       field.Pos(),
+		}
+		if tags.kind == KindParameter {
+			fieldInfo.Nilable = c.scope.isNilable(field.Type)
+			fieldInfo.Inject = tags.inject == "true" || tags.inject == "" && c.factory && c.scope.isDependency(field.Type)
+		}
+		if tags.inject != "" && !c.factory {
+			return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: inject needs -factory", fieldName)
+		}
+		exported := c.upperCamel(fieldName) == fieldName
+		switch {
+		case c.accessors && tags.getter != "":
+			// go-genaccessor generates the getter
+		case tags.getter == "true" && exported:
+			return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: exported fields cannot have a getter of the same name", fieldName)
+		case tags.getter == "true":
+			fieldInfo.GenGetter = true
+		case tags.getter == "":
+			fieldInfo.GenGetter = c.getters && !exported
+		case tags.getter != "false":
+			return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: getter tag needs \"true\", \"false\" or nothing", fieldName)
+		}
+		if tags.nonZero {
+			zero, ok := c.scope.zeroValue(field.Type)
+			if !ok {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: nonzero needs a number or string type", fieldName)
+			}
+			fieldInfo.NonZero = zero
+		}
+		if tags.group != "" {
+			zero, ok := c.scope.zeroValue(field.Type)
+			switch {
+			case fieldInfo.Nilable:
+				zero = "nil"
+			case !ok:
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: group needs a nilable, number or string type", fieldName)
+			}
+			fieldInfo.Group = tags.group
+			fieldInfo.groupZero = zero
+		}
+		if tags.copy == "true" || c.copy && tags.kind == KindParameter && tags.copy != "false" {
+			fieldInfo.Copy = c.scope.collectionKind(field.Type)
+			if fieldInfo.Copy == "" && tags.copy == "true" {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: copy needs a slice or map type", fieldName)
+			}
+		}
+		switch tags.deepCopy {
+		case "":
+		case "true":
+			star, ok := field.Type.(*ast.StarExpr)
+			if !ok {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: deepcopy needs a pointer type or a function", fieldName)
+			}
+			fieldInfo.Copy = "pointer"
+			if ident, ok := star.X.(*ast.Ident); ok && declaresMethod(walker.Pkg, ident.Name, "Clone") {
+				fieldInfo.Clone = "Clone"
+			}
+		default:
+			fieldInfo.Copy = "func"
+			if err := c.resolveExprImports(field, tags.deepCopy); err != nil {
+				return nil, "", err
+			}
+			fieldInfo.Clone = tags.deepCopy
+		}
+		if tags.transform != "" {
+			if !isFuncName(tags.transform) {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: transform must name a function, e.g. strings.TrimSpace", fieldName)
+			}
+			if err := c.resolveExprImports(field, tags.transform); err != nil {
+				return nil, "", err
+			}
+			fieldInfo.Transform = tags.transform
+		}
+		switch tags.kind {
+		case KindConstant:
+			if err := validateArrayConstValue(field.Type, tags.expr); err != nil {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: %v", fieldName, err)
+			}
+			if err := c.scope.checkConstValue(field.Type, tags.expr, isLocal); err != nil {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: %v", fieldName, err)
+			}
+			fieldInfo.ConstValue = tags.expr
+			fieldInfo.Optional = tags.optional
+		case KindDerived:
+			fieldInfo.Derived = tags.expr
+		}
+		if tags.nopDefault != "" {
+			nopDefault, err := nopDefaultValue(field.Type, tags.nopDefault)
+			if err != nil {
+				return nil, "", newDiagnostic(walker.FileSet.Position(field.Pos()), "field %s: %v", fieldName, err)
+			}
+			if err := c.resolveExprImports(field, nopDefault); err != nil {
+				return nil, "", err
+			}
+			fieldInfo.NopDefault = nopDefault
+		}
+		fieldInfos = append(fieldInfos, fieldInfo)
+
+		if tags.super {
+			superName = fieldName
+		}
+
+		// resolve imports
+		if tags.expr != "" {
+			if err := c.resolveExprImports(field, tags.expr); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		c.resolveTypeImports(field.Type)
+	}
+	return fieldInfos, superName, nil
+}
+
+// splitFieldNames returns fields with those declaring several names, such as
+// x, y int, split into a field for each name.
+func splitFieldNames(fields []*ast.Field) []*ast.Field {
+	split := make([]*ast.Field, 0, len(fields))
+	for _, field := range fields {
+		if len(field.Names) <= 1 {
+			split = append(split, field)
+			continue
+		}
+		for _, name := range field.Names {
+			f := *field
+			f.Names = []*ast.Ident{name}
+			split = append(split, &f)
+		}
+	}
+	return split
+}
+
+// protoimplPath is the package of the protobuf runtime internals generated
+// messages hold, such as protoimpl.MessageState.
+const protoimplPath = "google.golang.org/protobuf/runtime/protoimpl"
+
+// isProtoDataField reports whether field is a data field of a generated
+// protobuf message: an exported field which is neither of a protoimpl type
+// nor an XXX_ field of the older generators.
+func (c *fieldCollector) isProtoDataField(field *ast.Field) bool {
+	if len(field.Names) == 0 {
+		return false
+	}
+	name := field.Names[0].Name
+	if !ast.IsExported(name) || strings.HasPrefix(name, "XXX_") {
+		return false
+	}
+	if sel, ok := field.Type.(*ast.SelectorExpr); ok {
+		if ident, ok := sel.X.(*ast.Ident); ok && fileImports(c.walker.ToFile(field))[ident.Name] == protoimplPath {
+			return false
+		}
+	}
+	return true
+}
+
+// nopDefaultValue returns the value substituted for a nil parameter of type
+// typ by the nopdefault tag value. "true" stands for nop<Type>{}.
+func nopDefaultValue(typ ast.Expr, value string) (string, error) {
+	if value != "true" {
+		return value, nil
+	}
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return "nop" + strcase.ToUpperCamel(t.Name) + "{}", nil
+	case *ast.SelectorExpr:
+		return "nop" + strcase.ToUpperCamel(t.Sel.Name) + "{}", nil
+	}
+	return "", errors.New(`nopdefault:"true" needs a named type; give the no-op value instead`)
+}
+
+// resolveExprImports adds the imports referenced by expr, an expression
+// given in a tag of field.
+func (c *fieldCollector) resolveExprImports(field *ast.Field, expr string) error {
+	x, err := parser.ParseExpr(expr)
+	if err != nil {
+		return newDiagnostic(c.walker.FileSet.Position(field.Pos()), "invalid expression %q: %v", expr, err)
+	}
+	for n, pkg := range exprImports(x, fileImports(c.walker.ToFile(field))) {
+		if pkg != c.walker.PkgPath {
+			c.addImport(n, pkg)
+		}
+	}
+	return nil
+}
+
+// isFuncName reports whether s is a name or a qualified name such as
+// strings.TrimSpace, as a reference to a function is.
+func isFuncName(s string) bool {
+	x, err := parser.ParseExpr(s)
+	if err != nil {
+		return false
+	}
+	if sel, ok := x.(*ast.SelectorExpr); ok {
+		x = sel.X
+	}
+	_, ok := x.(*ast.Ident)
+	return ok
+}
+
+// addImport makes the generated file import the package at importPath by
+// name. Each name is imported once; another package imported by the same
+// name by another file sets importErr.
+func (c *fieldCollector) addImport(name, importPath string) {
+	if prev, ok := c.importPackages[name]; ok && prev != importPath {
+		if c.importErr == nil {
+			c.importErr = fmt.Errorf("%s is imported as both %q and %q", name, prev, importPath)
+		}
+		return
+	}
+	c.importPackages[name] = importPath
+}
+
+// resolveTypeImports adds the imports typ refers to through selectors,
+// including those of type arguments such as lru.Cache[string, *pb.User].
+func (c *fieldCollector) resolveTypeImports(typ ast.Expr) {
+	file := c.walker.ToFile(typ)
+	for n, pkg := range exprImports(typ, fileImports(file)) {
+		if pkg != c.walker.PkgPath {
+			c.addImport(n, pkg)
+		}
+	}
+	// the names of a dot-imported package cannot be told from those of
+	// another one, so only a single dot import is carried over
+	if dots := dotImports(file); len(dots) == 1 && c.refersToDotImport(typ) {
+		c.addImport(dotImportKey(dots[0]), dots[0])
+	}
+}
+
+// refersToDotImport reports whether typ refers to an identifier which is
+// neither declared in its file or package nor predeclared, and so comes
+// from a dot import.
+func (c *fieldCollector) refersToDotImport(typ ast.Expr) bool {
+	// names which are not references: selected names, and names of fields
+	// and parameters
+	skip := make(map[*ast.Ident]bool)
+	found := false
+	ast.Inspect(typ, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			// the package of a qualified name is imported by name
+			return false
+		case *ast.Field:
+			for _, name := range n.Names {
+				skip[name] = true
+			}
+		case *ast.Ident:
+			if skip[n] || n.Obj != nil || c.scope.declares(n.Name) || types.Universe.Lookup(n.Name) != nil {
+				return true
+			}
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// printExpr prints x as it is written, dropping comments and line breaks.
+// Types of the package and qualified ones print the same in the generated
+// file, which imports the same packages by the same names.
+func printExpr(x ast.Expr) (string, error) {
+	b := new(bytes.Buffer)
+	if err := printer.Fprint(b, token.NewFileSet(), x); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// resolveTypeName adds the import needed by name, a type name such as
+// Reader or io.Reader used in the file of node, and returns it. The package
+// can be given by its import path instead, e.g.
+// example.com/app/domain.OrderRepository, when the file does not import
+// it; the name is then returned qualified with the name of the package.
+func (c *fieldCollector) resolveTypeName(node ast.Node, name string) (string, error) {
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		dot := strings.LastIndex(name, ".")
+		if dot < slash || !token.IsIdentifier(name[dot+1:]) {
+			return "", fmt.Errorf("invalid type name %q", name)
+		}
+		return c.resolveImportedTypeName(node, name[:dot], name[dot+1:])
+	}
+	x, err := parser.ParseExpr(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid type name %q", name)
+	}
+	switch x := x.(type) {
+	case *ast.Ident:
+		return name, nil
+	case *ast.SelectorExpr:
+		pkg, ok := x.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		importPath, ok := fileImports(c.walker.ToFile(node))[pkg.Name]
+		if !ok {
+			return "", fmt.Errorf("package %s of %s is not imported", pkg.Name, name)
+		}
+		c.addImport(pkg.Name, importPath)
+		return name, nil
+	}
+	return "", fmt.Errorf("invalid type name %q", name)
+}
+
+// resolveImportedTypeName adds the import of the package importPath and
+// returns typeName qualified with the name the file of node imports it as,
+// or else with the name of the package, read from its directory if it is
+// found and guessed from importPath otherwise.
+func (c *fieldCollector) resolveImportedTypeName(node ast.Node, importPath, typeName string) (string, error) {
+	if importPath == c.walker.PkgPath {
+		return typeName, nil
+	}
+	for name, path := range fileImports(c.walker.ToFile(node)) {
+		if path == importPath {
+			c.addImport(name, importPath)
+			return name + "." + typeName, nil
+		}
+	}
+	name := importedName(importPath)
+	pos := c.walker.FileSet.Position(node.Pos())
+	if walker, err := c.importedWalker(importPath, filepath.Dir(pos.Filename)); err == nil {
+		name = walker.Pkg.Name
+		if walker.FindTypeSpec(func(spec *ast.TypeSpec) bool { return spec.Name.Name == typeName }) == nil {
+			return "", fmt.Errorf("type %s is not declared by package %s", typeName, importPath)
+		}
+	}
+	c.addImport(name, importPath)
+	return name + "." + typeName, nil
+}
+
+// collectEmbedded flattens the embedded field when it is a struct (or a
+// pointer to a struct) declared in the package or in another package of
+// the build.
+func (c *fieldCollector) collectEmbedded(field *ast.Field) (FieldInfo, bool, error) {
+	typ := field.Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if sel, ok := typ.(*ast.SelectorExpr); ok {
+		return c.collectImportedEmbedded(field, sel)
+	}
+	ident, ok := typ.(*ast.Ident)
+	if !ok {
+		return FieldInfo{}, false, nil
+	}
+	structType, ok := c.structTypes[ident.Name]
+	if !ok {
+		return FieldInfo{}, false, nil
+	}
+	if c.visiting[ident.Name] {
+		return FieldInfo{}, false, newDiagnostic(c.walker.FileSet.Position(field.Pos()), "cannot flatten %s: recursive embedding", ident.Name)
+	}
+
+	fields, _, err := c.collect(ident.Name, structType)
+	if err != nil {
+		return FieldInfo{}, false, err
+	}
+	printed, err := printExpr(field.Type)
+	if err != nil {
+		return FieldInfo{}, false, err
+	}
+	return FieldInfo{
+		Type:   printed,
+		Name:   ident.Name,
+		Kind:   KindFlattened,
+		Fields: fields,
+	}, true, nil
+}
+
+// collectImportedEmbedded flattens the embedded field of type sel, e.g.
+// base.Model, when it is a struct declared in an imported package found by
+// go/build. Its required fields must be exported, and its types and
+// expressions are qualified with the package.
+func (c *fieldCollector) collectImportedEmbedded(field *ast.Field, sel *ast.SelectorExpr) (FieldInfo, bool, error) {
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return FieldInfo{}, false, nil
+	}
+	importPath, ok := fileImports(c.walker.ToFile(field))[pkg.Name]
+	if !ok {
+		return FieldInfo{}, false, nil
+	}
+	pos := c.walker.FileSet.Position(field.Pos())
+	walker, err := c.importedWalker(importPath, filepath.Dir(pos.Filename))
+	if err != nil {
+		return FieldInfo{}, false, newDiagnostic(pos, "cannot flatten %s.%s: %v", pkg.Name, sel.Sel.Name, err)
+	}
+	var structType *ast.StructType
+	for _, spec := range walker.AllStructSpecs() {
+		if spec.Name.Name == sel.Sel.Name {
+			structType = spec.Type.(*ast.StructType)
+		}
+	}
+	if structType == nil {
+		return FieldInfo{}, false, nil
+	}
+
+	other := newFieldCollector(*walker, make(map[string]string), c.requiredKey)
+	other.flatten = true
+	other.qualifier = pkg.Name
+	other.initialisms = c.initialisms
+	other.importedWalkers = c.importedWalkers
+	fields, _, err := other.collect(sel.Sel.Name, structType)
+	if err != nil {
+		return FieldInfo{}, false, err
+	}
+	if err := checkSubpackageFields(fields, c.walker.Pkg.Name); err != nil {
+		return FieldInfo{}, false, newDiagnostic(pos, "cannot flatten %s.%s: %v", pkg.Name, sel.Sel.Name, err)
+	}
+	if err := other.qualifyFields(fields); err != nil {
+		return FieldInfo{}, false, newDiagnostic(pos, "cannot flatten %s.%s: %v", pkg.Name, sel.Sel.Name, err)
+	}
+	if other.importErr != nil {
+		return FieldInfo{}, false, newDiagnostic(pos, "cannot flatten %s.%s: %v", pkg.Name, sel.Sel.Name, other.importErr)
+	}
+	for name, importPath := range other.importPackages {
+		if importPath != c.walker.PkgPath {
+			c.addImport(name, importPath)
+		}
+	}
+	c.resolveTypeImports(field.Type)
+
+	printed, err := printExpr(field.Type)
+	if err != nil {
+		return FieldInfo{}, false, err
+	}
+	return FieldInfo{
+		Type:   printed,
+		Name:   sel.Sel.Name,
+		Kind:   KindFlattened,
+		Fields: fields,
+	}, true, nil
+}
+
+// importedWalker returns the package of importPath, imported from srcDir,
+// reading it the first time.
+func (c *fieldCollector) importedWalker(importPath, srcDir string) (*genutil.AstPkgWalker, error) {
+	if w, ok := c.importedWalkers[importPath]; ok {
+		return w, nil
+	}
+	dir, err := importDir(importPath, srcDir)
+	if err != nil {
+		return nil, err
+	}
+	m, err := genutil.DirToAstWalker(dir, func(finfo os.FileInfo) bool {
+		return !strings.HasSuffix(finfo.Name(), "_test.go")
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(m) != 1 {
+		return nil, fmt.Errorf("found %d packages in %s", len(m), dir)
+	}
+	var walker *genutil.AstPkgWalker
+	for name := range m {
+		w := m[name]
+		walker = &w
+	}
+	c.importedWalkers[importPath] = walker
+	return walker, nil
+}
+
+// importDir returns the directory of the package importPath imported from
+// srcDir: below the root of the module of srcDir if it is one of its
+// packages, or as go/build finds it otherwise.
+func importDir(importPath, srcDir string) (string, error) {
+	for modDir := srcDir; ; modDir = filepath.Dir(modDir) {
+		data, err := ioutil.ReadFile(filepath.Join(modDir, "go.mod"))
+		if err == nil {
+			modPath := ModulePath(data)
+			if importPath == modPath {
+				return modDir, nil
+			}
+			if rest := strings.TrimPrefix(importPath, modPath+"/"); modPath != "" && rest != importPath {
+				return filepath.Join(modDir, filepath.FromSlash(rest)), nil
+			}
+			break
+		}
+		if filepath.Dir(modDir) == modDir {
+			break
+		}
+	}
+	bpkg, err := build.Import(importPath, srcDir, build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+	return bpkg.Dir, nil
+}
+
+// isParam reports whether the field is taken as a constructor parameter.
+func (f FieldInfo) isParam() bool {
+	return f.Kind == KindParameter
+}
+
+// paramFields returns the fields taken as parameters in declaration order,
+// descending into flattened embedded structs.
+func paramFields(fields []FieldInfo) []FieldInfo {
+	params := make([]FieldInfo, 0, len(fields))
+	for _, f := range fields {
+		switch {
+		case f.Kind == KindFlattened:
+			params = append(params, paramFields(f.Fields)...)
+		case f.isParam():
+			params = append(params, f)
+		}
+	}
+	return params
+}
+
+// orderParams moves the parameters pinned with the order tag to their
+// positions, counting from 1, or from the end for negative ones, e.g. -1 for
+// the last parameter. The other parameters fill the remaining positions in
+// their declaration order.
+func orderParams(params []FieldInfo) error {
+	n := len(params)
+	ordered := make([]FieldInfo, n)
+	pinned := make([]*FieldInfo, n)
+	var rest []FieldInfo
+	for i := range params {
+		f := &params[i]
+		if f.Order == 0 {
+			rest = append(rest, *f)
+			continue
+		}
+		pos := f.Order - 1
+		if f.Order < 0 {
+			pos = n + f.Order
+		}
+		if pos < 0 || pos >= n {
+			return fmt.Errorf("field %s: order %d is out of the %d parameters", f.Name, f.Order, n)
+		}
+		switch other := pinned[pos]; {
+		case other != nil && other.Order == f.Order:
+			return fmt.Errorf("fields %s and %s have the same order %d", other.Name, f.Name, f.Order)
+		case other != nil:
+			return fmt.Errorf("fields %s and %s are both ordered at position %d", other.Name, f.Name, pos+1)
+		}
+		pinned[pos] = f
+		ordered[pos] = *f
+	}
+	for i := range ordered {
+		if pinned[i] == nil {
+			ordered[i], rest = rest[0], rest[1:]
+		}
+	}
+	copy(params, ordered)
+	return nil
+}
+
+// check is a comparison a parameter field of a valid struct fails.
+type check struct {
+	// Selector selects the field from the struct.
+	Selector string
+	// Zero is the value the field must not be equal to, and Desc describes
+	// it, as in "must not be nil".
+	Zero string
+	Desc string
+}
+
+// validationChecks returns the checks of the nilable parameter fields and of
+// those tagged with nonzero, descending into flattened embedded structs held
+// by value.
+func validationChecks(fields []FieldInfo, path []string) []check {
+	var checks []check
+	for _, f := range fields {
+		selector := strings.Join(append(path, f.Name), ".")
+		switch {
+		case f.Kind == KindFlattened:
+			if !strings.HasPrefix(f.Type, "*") {
+				checks = append(checks, validationChecks(f.Fields, append(path, f.Name))...)
+			}
+		case f.Kind != KindParameter:
+		case f.Group != "":
+			// checked with the group
+		case f.NonZero == `""`:
+			checks = append(checks, check{Selector: selector, Zero: f.NonZero, Desc: "empty"})
+		case f.NonZero != "":
+			checks = append(checks, check{Selector: selector, Zero: f.NonZero, Desc: "zero"})
+		case f.Nilable:
+			checks = append(checks, check{Selector: selector, Zero: "nil", Desc: "nil"})
+		}
+	}
+	return checks
+}
+
+// groupCheck is a group of parameter fields a valid struct has all or none
+// of set.
+type groupCheck struct {
+	Name    string
+	Members []check
+	// Fields lists the selectors of Members, as in "user, password".
+	Fields string
+}
+
+// groupChecks returns the checks of the groups of parameter fields in the
+// order they first appear, descending into flattened embedded structs held
+// by value like validationChecks.
+func groupChecks(fields []FieldInfo) []groupCheck {
+	var groups []groupCheck
+	index := make(map[string]int)
+	var walk func(fields []FieldInfo, path []string)
+	walk = func(fields []FieldInfo, path []string) {
+		for _, f := range fields {
+			switch {
+			case f.Kind == KindFlattened:
+				if !strings.HasPrefix(f.Type, "*") {
+					walk(f.Fields, append(path, f.Name))
+				}
+			case f.Group != "":
+				i, ok := index[f.Group]
+				if !ok {
+					i = len(groups)
+					index[f.Group] = i
+					groups = append(groups, groupCheck{Name: f.Group})
+				}
+				selector := strings.Join(append(path, f.Name), ".")
+				groups[i].Members = append(groups[i].Members, check{Selector: selector, Zero: f.groupZero})
+			}
+		}
+	}
+	walk(fields, nil)
+	for i := range groups {
+		selectors := make([]string, 0, len(groups[i].Members))
+		for _, m := range groups[i].Members {
+			selectors = append(selectors, m.Selector)
+		}
+		groups[i].Fields = strings.Join(selectors, ", ")
+	}
+	return groups
+}
+
+// assignment is a statement assigning Value to the field selected by Target.
+type assignment struct {
+	Target string
+	Value  string
+}
+
+// derivedAssignments returns the assignments of derived fields, selecting
+// fields of flattened embedded structs through path.
+func derivedAssignments(fields []FieldInfo, path []string) []assignment {
+	var assignments []assignment
+	for _, f := range fields {
+		switch {
+		case f.Kind == KindFlattened:
+			assignments = append(assignments, derivedAssignments(f.Fields, append(path, f.Name))...)
+		case f.Derived != "":
+			assignments = append(assignments, assignment{
+				Target: strings.Join(append(path, f.Name), "."),
+				Value:  f.Derived,
+			})
+		}
+	}
+	return assignments
+}
+
+// assignParamNames makes the parameter names of flattened fields unique.
+// Fields of the struct itself keep their names; a flattened field colliding
+// with another parameter is qualified by the name of its embedded struct,
+// e.g. baseID.
+// A collision left is reported with the positions of both fields in fset.
+func assignParamNames(fset *token.FileSet, fields []FieldInfo) error {
+	used := make(map[string]FieldInfo, len(fields))
+	for _, f := range fields {
+		if f.isParam() {
+			used[f.ParamName] = f
+		}
+	}
+	return assignFlattenedParamNames(fset, fields, used)
+}
+
+func assignFlattenedParamNames(fset *token.FileSet, fields []FieldInfo, used map[string]FieldInfo) error {
+	for i := range fields {
+		f := &fields[i]
+		if f.Kind != KindFlattened {
+			continue
+		}
+		for j := range f.Fields {
+			ff := &f.Fields[j]
+			if !ff.isParam() {
+				continue
+			}
+			if _, ok := used[ff.ParamName]; ok {
+				qualified := strcase.ToLowerCamel(f.Name) + strcase.ToUpperCamel(ff.Name)
+				if other, ok := used[qualified]; ok {
+					return fmt.Errorf("parameter %s of embedded %s.%s (%s) collides with the one of field %s (%s)", qualified, f.Name, ff.Name, fset.Position(ff.pos), other.Name, fset.Position(other.pos))
+				}
+				ff.ParamName = qualified
+			}
+			used[ff.ParamName] = *ff
+		}
+		if err := assignFlattenedParamNames(fset, f.Fields, used); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1334 @@
+package genconstructor_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GuiltyMorishita/go-genconstructor/genconstructor"
+)
+
+func TestRun_flatten(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "embedded structs",
+			src: `package a
+
+import "time"
+
+type Base struct {
+	id        string    ` + "`required:\"\"`" + `
+	createdAt time.Time ` + "`required:\"time.Now()\"`" + `
+	note      string
+}
+
+type Audit struct {
+	Base
+	by string ` + "`required:\"\"`" + `
+}
+
+//genconstructor -flatten
+type Foo struct {
+	*Audit
+	name string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFoo(
+	id string,
+	by string,
+	name string,
+) Foo {
+	return Foo{
+		Audit: &Audit{
+			Base: Base{
+				id:        id,
+				createdAt: time.Now(),
+			},
+			by: by,
+		},
+		name: name,
+	}
+}
+`,
+		},
+		{
+			name: "shadowed names are qualified",
+			src: `package a
+
+type Base struct {
+	id string ` + "`required:\"\"`" + `
+}
+
+//genconstructor -flatten
+type Foo struct {
+	Base
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFoo(
+	baseID string,
+	id string,
+) Foo {
+	return Foo{
+		Base: Base{
+			id: baseID,
+		},
+		id: id,
+	}
+}
+`,
+		},
+		{
+			name: "shadowed exported names",
+			src: `package a
+
+type Base struct {
+	ID string ` + "`required:\"\"`" + `
+}
+
+//genconstructor -flatten
+type Foo struct {
+	Base
+	ID string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFoo(
+	baseID string,
+	id string,
+) Foo {
+	return Foo{
+		Base: Base{
+			ID: baseID,
+		},
+		ID: id,
+	}
+}
+`,
+		},
+		{
+			name: "qualified name collides",
+			src: `package a
+
+type Base struct {
+	key string ` + "`required:\"\"`" + `
+}
+
+//genconstructor -flatten
+type Foo struct {
+	Base
+	key     string ` + "`required:\"\"`" + `
+	baseKey string ` + "`required:\"\"`" + `
+}
+`,
+			wantErr: "a.go:4:2) collides with the one of field baseKey (",
+		},
+		{
+			name: "without flatten",
+			src: `package a
+
+type Base struct {
+	id string ` + "`required:\"\"`" + `
+}
+
+//genconstructor
+type Foo struct {
+	Base
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFoo(
+	id string,
+) Foo {
+	return Foo{
+		id: id,
+	}
+}
+`,
+		},
+		{
+			name: "recursive embedding",
+			src: `package a
+
+type Bar struct {
+	*Foo
+}
+
+//genconstructor -flatten
+type Foo struct {
+	*Bar
+}
+`,
+			wantErr: "cannot flatten Foo: recursive embedding",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got:\n%s\nwant suffix:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_flattenImported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.18\n",
+		"base/base.go": `package base
+
+import "time"
+
+type ID string
+
+type Model struct {
+	ID        ID        ` + "`required:\"\"`" + `
+	CreatedAt time.Time ` + "`required:\"time.Now()\"`" + `
+	Version   int       ` + "`required:\"DefaultVersion\"`" + `
+}
+
+const DefaultVersion = 1
+
+type Hidden struct {
+	id ID ` + "`required:\"\"`" + `
+}
+`,
+		"a/a.go": `package a
+
+import "example.com/m/base"
+
+//genconstructor -flatten
+type Foo struct {
+	base.Model
+	name string ` + "`required:\"\"`" + `
+}
+`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func() (string, error) {
+		out := new(bytes.Buffer)
+		err := genconstructor.Run(filepath.Join(dir, "a"), func(pkg *ast.Package) io.Writer {
+			return out
+		})
+		return out.String(), err
+	}
+
+	got, err := run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"time"`,
+		`func NewFoo(
+	id base.ID,
+	name string,
+) Foo {
+	return Foo{
+		Model: base.Model{
+			ID:        id,
+			CreatedAt: time.Now(),
+			Version:   base.DefaultVersion,
+		},
+		name: name,
+	}
+}
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+
+	a := strings.Replace(files["a/a.go"], "base.Model", "base.Hidden", 1)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a", "a.go"), []byte(a), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := "cannot flatten base.Hidden: field id is unexported and cannot be set from package a"
+	if _, err := run(); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestRun_derived(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "value",
+			src: `package a
+
+import "strings"
+
+//genconstructor
+type Foo struct {
+	name string ` + "`required:\"\"`" + `
+	key  string ` + "`derived:\"strings.ToLower(name)\"`" + `
+}
+`,
+			want: `import (
+	"strings"
+)
+
+func NewFoo(
+	name string,
+) Foo {
+	foo := Foo{
+		name: name,
+	}
+	foo.key = strings.ToLower(name)
+	return foo
+}
+`,
+		},
+		{
+			name: "pointer with named return",
+			src: `package a
+
+//genconstructor -p -named-return
+type Foo struct {
+	name string ` + "`required:\"\"`" + `
+	id   string ` + "`derived:\"computeID(name)\"`" + `
+}
+`,
+			want: `func NewFoo(
+	name string,
+) (foo *Foo) {
+	foo = &Foo{
+		name: name,
+	}
+	foo.id = computeID(name)
+	return foo
+}
+`,
+		},
+		{
+			name: "flattened",
+			src: `package a
+
+type Base struct {
+	id string ` + "`derived:\"computeID(name)\"`" + `
+}
+
+//genconstructor -flatten
+type Foo struct {
+	Base
+	name string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFoo(
+	name string,
+) Foo {
+	foo := Foo{
+		Base: Base{},
+		name: name,
+	}
+	foo.Base.id = computeID(name)
+	return foo
+}
+`,
+		},
+		{
+			name: "with required",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\" derived:\"computeID()\"`" + `
+}
+`,
+			wantErr: "a.go:5:2: derived field cannot be tagged with required or super",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got:\n%s\nwant suffix:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_nopDefault(t *testing.T) {
+	src := `package a
+
+import "example.com/trace"
+
+//genconstructor
+type Foo struct {
+	name    string       ` + "`required:\"\"`" + `
+	metrics Metrics      ` + "`required:\"\" nopdefault:\"true\"`" + `
+	tracer  trace.Tracer ` + "`required:\"\" nopdefault:\"trace.NopTracer()\"`" + `
+	logger  Logger       ` + "`required:\"\" nopdefault:\"false\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"example.com/trace"
+)
+
+func NewFoo(
+	name string,
+	metrics Metrics,
+	tracer trace.Tracer,
+	logger Logger,
+) Foo {
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+	if tracer == nil {
+		tracer = trace.NopTracer()
+	}
+	return Foo{
+		name:    name,
+		metrics: metrics,
+		tracer:  tracer,
+		logger:  logger,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	_, err = generate(t, `package a
+
+//genconstructor
+type Foo struct {
+	metrics Metrics `+"`required:\"newMetrics()\" nopdefault:\"true\"`"+`
+}
+`)
+	if err == nil || !strings.Contains(err.Error(), "nopdefault can only be used on parameter fields") {
+		t.Errorf("error = %v, want nopdefault on constant field to be rejected", err)
+	}
+}
+
+func TestRun_constValueImports(t *testing.T) {
+	src := `package a
+
+import (
+	"math/rand"
+	"time"
+
+	str "strings"
+	"github.com/x/unused"
+)
+
+//genconstructor
+type Foo struct {
+	timeout time.Duration ` + "`required:\"time.Duration(30) * time.Second\"`" + `
+	jitter  time.Duration ` + "`required:\"time.Duration(rand.Int63n(int64(time.Second)))\"`" + `
+	name    string        ` + "`required:\"str.ToUpper(\\\"a, b\\\")\"`" + `
+	ids     []int         ` + "`required:\"[]int{1, 2, int(time.Hour / time.Minute)}\"`" + `
+}
+
+var _ = unused.X
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"math/rand"
+	str "strings"
+	"time"
+)
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant imports:\n%s", got, want)
+	}
+}
+
+func TestRun_interpretedTags(t *testing.T) {
+	// double-quoted tags can hold backticks, e.g. for raw string values
+	src := "package a\n\n//genconstructor\ntype Foo struct {\n" +
+		"\tpattern string \"required:\\\"`^a+$`\\\"\"\n" +
+		"\tname    string \"required:\\\"\\\\\\\"bob\\\\\\\"\\\"\"\n" +
+		"\tkey     string `required:\"\"`\n" +
+		"}\n"
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "func NewFoo(\n\tkey string,\n) Foo {\n\treturn Foo{\n" +
+		"\t\tpattern: `^a+$`,\n" +
+		"\t\tname:    \"bob\",\n" +
+		"\t\tkey:     key,\n" +
+		"\t}\n}\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRun_constValueCommas(t *testing.T) {
+	src := `package a
+
+import (
+	"strings"
+	"time"
+)
+
+//genconstructor
+type Foo struct {
+	counts  map[string]int           ` + "`required:\"map[string]int{\\\"a\\\": 1, \\\"b\\\": 2}\"`" + `
+	sep     string                   ` + "`required:\"strings.Join([]string{\\\"a\\\", \\\"b\\\"}, \\\",\\\")\"`" + `
+	timeout map[string]time.Duration ` + "`required:\"map[string]time.Duration{\\\"a,b\\\": time.Second}\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"strings"
+	"time"
+)
+
+func NewFoo() Foo {
+	return Foo{
+		counts:  map[string]int{"a": 1, "b": 2},
+		sep:     strings.Join([]string{"a", "b"}, ","),
+		timeout: map[string]time.Duration{"a,b": time.Second},
+	}
+}
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRun_order(t *testing.T) {
+	src := `package a
+
+type Base struct {
+	id      string ` + "`required:\"\" order:\"1\"`" + `
+	version int    ` + "`required:\"\"`" + `
+}
+
+//genconstructor -flatten
+type Foo struct {
+	Base
+	name  string ` + "`required:\"\" order:\"2\"`" + `
+	extra string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func NewFoo(
+	id string,
+	name string,
+	version int,
+	extra string,
+) Foo {
+	return Foo{
+		Base: Base{
+			id:      id,
+			version: version,
+		},
+		name:  name,
+		extra: extra,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	t.Run("same order", func(t *testing.T) {
+		_, err := generate(t, `package a
+
+//genconstructor
+type Foo struct {
+	id   string `+"`required:\"\" order:\"1\"`"+`
+	name string `+"`required:\"\" order:\"1\"`"+`
+}
+`)
+		if err == nil || !strings.Contains(err.Error(), "fields id and name have the same order 1") {
+			t.Errorf("error = %v, want same order to be rejected", err)
+		}
+	})
+
+	for _, tt := range []struct {
+		fields string
+		want   string
+	}{
+		{fields: "a int `required:\"\" order:\"3\"`\nb int `required:\"\"`", want: "field a: order 3 is out of the 2 parameters"},
+		{fields: "a int `required:\"\" order:\"2\"`\nb int `required:\"\" order:\"-1\"`", want: "fields a and b are both ordered at position 2"},
+	} {
+		_, err := generate(t, "package a\n\n//genconstructor\ntype Foo struct {\n"+tt.fields+"\n}\n")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v, want %q", err, tt.want)
+		}
+	}
+
+	t.Run("without required", func(t *testing.T) {
+		got, err := generate(t, `package a
+
+//genconstructor -all
+type Foo struct {
+	Note string `+"`json:\"note\" order:\"-1\"`"+`
+	ID   string `+"`order:\"1\"`"+`
+	Name string
+	Age  int
+}
+`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "func NewFoo(\n\tid string,\n\tname string,\n\tage int,\n\tnote string,\n) Foo {"
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	})
+}
+
+func TestRun_proto(t *testing.T) {
+	src := `package a
+
+import (
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+)
+
+//genconstructor -proto
+type User struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id      string   ` + "`protobuf:\"bytes,1,opt,name=id,proto3\" json:\"id,omitempty\"`" + `
+	Tags    []string ` + "`protobuf:\"bytes,2,rep,name=tags,proto3\" json:\"tags,omitempty\"`" + `
+	Profile *Profile ` + "`protobuf:\"bytes,3,opt,name=profile,proto3\" json:\"profile,omitempty\"`" + `
+
+	XXX_unrecognized []byte
+}
+
+type Profile struct{}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func NewUser(
+	id string,
+	tags []string,
+	profile *Profile,
+) *User {
+	return &User{
+		Id:      id,
+		Tags:    tags,
+		Profile: profile,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+	if strings.Contains(got, "protoimpl") {
+		t.Errorf("got:\n%s\nwant no protoimpl import", got)
+	}
+}
+
+func TestRun_all(t *testing.T) {
+	src := `package a
+
+type Base struct {
+	id string ` + "`required:\"\"`" + `
+}
+
+type Meta struct{}
+
+//genconstructor -all -flatten
+type OrderDTO struct {
+	Base
+	Meta     ` + "`genconstructor:\"-\"`" + `
+	ID, Name string ` + "`json:\"name\"`" + `
+	Qty      int
+	Version  int    ` + "`required:\"1\"`" + `
+	Cache    []byte ` + "`ctorignore:\"true\"`" + `
+	lazy     map[string]int ` + "`json:\"-\" genconstructor:\"-\"`" + `
+	_        struct{}
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func NewOrderDTO(
+	baseID string,
+	id string,
+	name string,
+	qty int,
+) OrderDTO {
+	return OrderDTO{
+		Base: Base{
+			id: baseID,
+		},
+		ID:      id,
+		Name:    name,
+		Qty:     qty,
+		Version: 1,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+}
+
+func TestRun_ctorIgnore(t *testing.T) {
+	src := `package a
+
+type Base struct {
+	owner string ` + "`required:\"\"`" + `
+}
+
+//genconstructor -flatten
+type Foo struct {
+	Base  ` + "`ctorignore:\"true\"`" + `
+	key   string            ` + "`required:\"\"`" + `
+	cache map[string]string ` + "`ctorignore:\"true\"`" + `
+}
+
+//genconstructor -proto
+type Message struct {
+	Name  string
+	Cache map[string]string ` + "`ctorignore:\"true\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`func NewFoo(
+	key string,
+) Foo {
+	return Foo{
+		key: key,
+	}
+}
+`,
+		`func NewMessage(
+	name string,
+) *Message {
+	return &Message{
+		Name: name,
+	}
+}
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestRun_aliasTypes(t *testing.T) {
+	src := `package a
+
+import "time"
+
+type Count = int
+
+type Timeout = time.Duration
+
+//genconstructor
+type Foo struct {
+	count   Count   ` + "`required:\"\"`" + `
+	timeout Timeout ` + "`required:\"\"`" + `
+	retries Count   ` + "`required:\"Count(3)\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package a
+
+func NewFoo(
+	count Count,
+	timeout Timeout,
+) Foo {
+	return Foo{
+		count:   count,
+		timeout: timeout,
+		retries: Count(3),
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+}
+
+func TestRun_genericFieldTypes(t *testing.T) {
+	src := `package a
+
+import (
+	lru "github.com/hashicorp/golang-lru/v2"
+	pb "example.com/api/userpb"
+)
+
+type User struct{}
+
+//genconstructor
+type Foo struct {
+	cache  lru.Cache[string, *User]         ` + "`required:\"\"`" + `
+	protos *lru.Cache[pb.ID, []*pb.User]    ` + "`required:\"\"`" + `
+	byID   map[pb.ID]lru.Cache[int, string] ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	pb "example.com/api/userpb"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+func NewFoo(
+	cache lru.Cache[string, *User],
+	protos *lru.Cache[pb.ID, []*pb.User],
+	byID map[pb.ID]lru.Cache[int, string],
+) Foo {
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRun_typeImports(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "dot import",
+			src: `package a
+
+import (
+	. "time"
+)
+
+//genconstructor
+type Foo[T any] struct {
+	timeout Duration          ` + "`required:\"\"`" + `
+	values  map[string][]T    ` + "`required:\"\"`" + `
+	now     func() (t Time)   ` + "`required:\"\"`" + `
+}
+`,
+			want: `import (
+	. "time"
+)
+`,
+		},
+		{
+			name: "package name other than the path",
+			src: `package a
+
+import (
+	"strings"
+
+	"example.com/go-yaml-fork"
+)
+
+var _ = strings.TrimSpace
+
+//genconstructor
+type Foo struct {
+	node yaml.Node ` + "`required:\"\"`" + `
+}
+`,
+			want: `import (
+	yaml "example.com/go-yaml-fork"
+)
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	// only T of the package, so no dot import
+	got, err := generate(t, `package a
+
+import . "time"
+
+var _ = Now
+
+type T struct{}
+
+//genconstructor
+type Foo struct {
+	t T `+"`required:\"\"`"+`
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "import") {
+		t.Errorf("got:\n%s\nwant no imports", got)
+	}
+}
+
+func TestRun_nestedPointerTypes(t *testing.T) {
+	src := `package a
+
+import "bytes"
+
+type T struct{}
+
+type Digest *[32]byte
+
+//genconstructor -validate-method
+type Foo struct {
+	buf    *[16]byte                    ` + "`required:\"\"`" + `
+	pp     **T                          ` + "`required:\"\"`" + `
+	byKey  *map[string]*bytes.Buffer    ` + "`required:\"\"`" + `
+	digest Digest                       ` + "`required:\"\"`" + `
+	bufs   [4]*bytes.Buffer             ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`import (
+	"bytes"
+	"errors"
+)
+`,
+		`func NewFoo(
+	buf *[16]byte,
+	pp **T,
+	byKey *map[string]*bytes.Buffer,
+	digest Digest,
+	bufs [4]*bytes.Buffer,
+) Foo {
+`,
+		`func (x Foo) Validate() error {
+	if x.buf == nil {
+		return errors.New("Foo.buf must not be nil")
+	}
+	if x.pp == nil {
+		return errors.New("Foo.pp must not be nil")
+	}
+	if x.byKey == nil {
+		return errors.New("Foo.byKey must not be nil")
+	}
+	if x.digest == nil {
+		return errors.New("Foo.digest must not be nil")
+	}
+	return nil
+}
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestRun_funcFieldTypes(t *testing.T) {
+	src := `package a
+
+import (
+	"context"
+	"net/http"
+
+	pb "example.com/api/userpb"
+)
+
+type User struct{}
+
+//genconstructor
+type Foo struct {
+	fetch  func(ctx context.Context, key string) (*User, error)     ` + "`required:\"\"`" + `
+	lookup func(context.Context, ...pb.ID) (map[pb.ID]*User, error) ` + "`required:\"\"`" + `
+	wrap   func(http.Handler) http.Handler                          ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"context"
+	"net/http"
+
+	pb "example.com/api/userpb"
+)
+
+func NewFoo(
+	fetch func(ctx context.Context, key string) (*User, error),
+	lookup func(context.Context, ...pb.ID) (map[pb.ID]*User, error),
+	wrap func(http.Handler) http.Handler,
+) Foo {
+	return Foo{
+		fetch:  fetch,
+		lookup: lookup,
+		wrap:   wrap,
+	}
+}
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRun_transform(t *testing.T) {
+	src := `package a
+
+import "strings"
+
+func normalize(s string) string { return strings.ToLower(s) }
+
+//genconstructor
+type Foo struct {
+	name  string ` + "`required:\"\" transform:\"strings.TrimSpace\"`" + `
+	email string ` + "`required:\"\" transform:\"normalize\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"strings"
+)
+
+func NewFoo(
+	name string,
+	email string,
+) Foo {
+	return Foo{
+		name:  strings.TrimSpace(name),
+		email: normalize(email),
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	t.Run("not a function name", func(t *testing.T) {
+		_, err := generate(t, `package a
+
+//genconstructor
+type Foo struct {
+	name string `+"`required:\"\" transform:\"f(x)\"`"+`
+}
+`)
+		if err == nil || !strings.Contains(err.Error(), "field name: transform must name a function") {
+			t.Errorf("error = %v, want transform to be rejected", err)
+		}
+	})
+}
+
+func TestRun_copy(t *testing.T) {
+	src := `package a
+
+type IDs []string
+
+//genconstructor -copy
+type Order struct {
+	ids    IDs               ` + "`required:\"\"`" + `
+	lines  []string          ` + "`required:\"\" transform:\"normalize\"`" + `
+	labels map[string]string ` + "`required:\"\"`" + `
+	shared []byte            ` + "`required:\"\" copy:\"false\"`" + `
+	name   string            ` + "`required:\"\"`" + `
+}
+
+//genconstructor
+type Line struct {
+	tags []string ` + "`required:\"\" copy:\"true\"`" + `
+	refs []string ` + "`required:\"\"`" + `
+}
+
+func normalize(s []string) []string { return s }
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`	return Order{
+		ids:   append(IDs(nil), ids...),
+		lines: append([]string(nil), normalize(lines)...),
+		labels: func(m map[string]string) map[string]string {
+			if m == nil {
+				return nil
+			}
+			c := make(map[string]string, len(m))
+			for k, v := range m {
+				c[k] = v
+			}
+			return c
+		}(labels),
+		shared: shared,
+		name:   name,
+	}
+`,
+		`	return Line{
+		tags: append([]string(nil), tags...),
+		refs: refs,
+	}
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+
+	want := "field name: copy needs a slice or map type"
+	if _, err := generate(t, "package a\n\n//genconstructor\ntype Foo struct {\n\tname string `required:\"\" copy:\"true\"`\n}\n"); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestRun_deepCopy(t *testing.T) {
+	src := `package a
+
+import "net/url"
+
+type Address struct {
+	city string
+}
+
+type Money struct {
+	amount int64
+}
+
+func (m *Money) Clone() *Money {
+	c := *m
+	return &c
+}
+
+//genconstructor
+type Customer struct {
+	address *Address ` + "`required:\"\" deepcopy:\"\"`" + `
+	credit  *Money   ` + "`required:\"\" deepcopy:\"true\"`" + `
+	site    *url.URL ` + "`required:\"\" deepcopy:\"cloneURL\"`" + `
+	tags    []string ` + "`required:\"\" deepcopy:\"cloneTags\"`" + `
+}
+
+func cloneURL(u *url.URL) *url.URL { return u }
+
+func cloneTags(tags []string) []string { return tags }
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `	return Customer{
+		address: func(p *Address) *Address {
+			if p == nil {
+				return nil
+			}
+			c := *p
+			return &c
+		}(address),
+		credit: func(p *Money) *Money {
+			if p == nil {
+				return nil
+			}
+			return p.Clone()
+		}(credit),
+		site: cloneURL(site),
+		tags: cloneTags(tags),
+	}
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	want = "field name: deepcopy needs a pointer type or a function"
+	if _, err := generate(t, "package a\n\n//genconstructor\ntype Foo struct {\n\tname string `required:\"\" deepcopy:\"\"`\n}\n"); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestRun_importsOnce(t *testing.T) {
+	got, err := generateFiles(t, map[string]string{
+		"a.go": `package a
+
+import "time"
+
+//genconstructor
+type Foo struct {
+	timeout time.Duration            ` + "`required:\"\"`" + `
+	at      map[time.Month]time.Time ` + "`required:\"\"`" + `
+}
+`,
+		"b.go": `package a
+
+import "time"
+
+//genconstructor
+type Bar struct {
+	every time.Duration ` + "`required:\"\"`" + `
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(got, `"time"`); n != 1 {
+		t.Errorf("got:\n%s\nwant time imported once, not %d times", got, n)
+	}
+
+	_, err = generateFiles(t, map[string]string{
+		"a.go": `package a
+
+import yaml "example.com/yaml"
+
+//genconstructor
+type Foo struct {
+	node yaml.Node ` + "`required:\"\"`" + `
+}
+`,
+		"b.go": `package a
+
+import yaml "example.com/fork/yaml"
+
+//genconstructor
+type Bar struct {
+	node yaml.Node ` + "`required:\"\"`" + `
+}
+`,
+	})
+	if want := `Bar: yaml is imported as both "example.com/yaml" and "example.com/fork/yaml"`; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestRun_default(t *testing.T) {
+	src := `package a
+
+import "time"
+
+//genconstructor %s
+type Client struct {
+	addr    string        ` + "`required:\"\"`" + `
+	timeout time.Duration ` + "`default:\"30 * time.Second\"`" + `
+}
+`
+	got, err := generate(t, fmt.Sprintf(src, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"time"
+)
+
+func NewClient(
+	addr string,
+) Client {
+	return Client{
+		addr:    addr,
+		timeout: 30 * time.Second,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	// an option overrides the default
+	if got, err = generate(t, fmt.Sprintf(src, "-options")); err != nil {
+		t.Fatal(err)
+	}
+	want = `func WithTimeout(timeout time.Duration) ClientOption {`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRun_defaultOfOtherPackages(t *testing.T) {
+	// the default tags of envconfig and creasty/defaults, which are not Go
+	// expressions of the package, are left to them
+	got, err := generate(t, `package a
+
+const defaultPort = 8080
+
+//genconstructor
+type Config struct {
+	Host    string `+"`env:\"HOST\" default:\"localhost\"`"+`
+	Port    int    `+"`env:\"PORT\" default:\"defaultPort\"`"+`
+	Timeout string `+"`env:\"TIMEOUT\" default:\"30s\"`"+`
+	Region  string `+"`required:\"\" default:\"us-east-1\"`"+`
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func NewConfig(
+	region string,
+) Config {
+	return Config{
+		Port:   defaultPort,
+		Region: region,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+}
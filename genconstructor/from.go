@@ -0,0 +1,79 @@
+package genconstructor
+
+import (
+	"fmt"
+
+	"github.com/GuiltyMorishita/go-genutil/genutil"
+)
+
+// fromMapping is a conversion constructor building a struct from another
+// struct of the package (-from=Type) through the constructor of the struct.
+type fromMapping struct {
+	// Type is the struct converted from and Name the parameter holding it.
+	Type string
+	Name string
+	// Params are the declarations of the parameters of the fields Type has
+	// no counterpart for.
+	Params []string
+	// Args are the arguments passed to the constructor.
+	Args []string
+}
+
+// fromMapping maps the parameters of a struct to the fields of the struct
+// typeName declared in the package: those of the same name, or the same
+// name but exported, and written with the same type. Without type
+// information, types differently written are not known to be assignable and
+// are taken as parameters.
+func (c *fieldCollector) fromMapping(typeName string, params []FieldInfo) (*fromMapping, error) {
+	structType, ok := c.structTypes[typeName]
+	if !ok {
+		return nil, fmt.Errorf("-from=%s: not a struct declared in the package", typeName)
+	}
+	if c.genericStructs[typeName] {
+		return nil, fmt.Errorf("-from=%s: cannot convert from a generic struct", typeName)
+	}
+	srcTypes := make(map[string]string)
+	for _, field := range structType.Fields.List {
+		typ, err := printExpr(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		if len(field.Names) == 0 {
+			srcTypes[genutil.ParseFieldName(field)] = typ
+		}
+		for _, name := range field.Names {
+			srcTypes[name.Name] = typ
+		}
+	}
+
+	m := &fromMapping{
+		Type: typeName,
+		Name: lowerCamel(typeName),
+	}
+	for _, p := range params {
+		if p.ParamName == m.Name {
+			m.Name = "src" + c.upperCamel(typeName)
+		}
+	}
+	for _, p := range params {
+		if name, ok := matchField(srcTypes, p, c.upperCamel); ok {
+			m.Args = append(m.Args, m.Name+"."+name)
+			continue
+		}
+		m.Params = append(m.Params, p.ParamName+" "+p.Type)
+		m.Args = append(m.Args, p.ParamName)
+	}
+	return m, nil
+}
+
+// matchField returns the field of srcTypes, a map from field names to
+// types, which the parameter field p is set from, by its name or its name
+// exported by upperCamel.
+func matchField(srcTypes map[string]string, p FieldInfo, upperCamel func(string) string) (string, bool) {
+	for _, name := range []string{p.Name, upperCamel(p.Name)} {
+		if typ, ok := srcTypes[name]; ok && typ == p.Type {
+			return name, true
+		}
+	}
+	return "", false
+}
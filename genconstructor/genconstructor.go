@@ -18,14 +18,21 @@ package genconstructor
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"go/ast"
+	"go/build/constraint"
 	"go/format"
+	"go/parser"
+	"go/token"
 	"io"
+	"io/ioutil"
 	"os"
-	"reflect"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"text/template"
-	"unicode"
 
 	"github.com/GuiltyMorishita/go-genutil/genutil"
 	"github.com/hori-ryota/go-strcase"
@@ -36,6 +43,27 @@ const (
 	pointerOpts   = "-p"
 	superOpts     = "-s"
 	extendsOpts   = "-e"
+
+	namedReturnOpts = "-named-return"
+	flattenOpts     = "-flatten"
+
+	validateMethodOpts = "-validate-method"
+	gettersOpts        = "-g"
+	longGettersOpts    = "-getters"
+	protoOpts          = "-proto"
+	returnOpts         = "-return"
+	fromOpts           = "-from"
+	pairOpts           = "-pair"
+	optionsOpts        = "-options"
+	errorOpts          = "-error"
+	nilCheckOpts       = "-nilcheck"
+	nameOpts           = "-name"
+	unexportedOpts     = "-unexported"
+	allOpts            = "-all"
+	copyOpts           = "-copy"
+	reconstructOpts    = "-reconstruct"
+	asOpts             = "-as"
+	factoryOpts        = "-factory"
 )
 
 type Option func(o *option)
@@ -43,6 +71,86 @@ type Option func(o *option)
 type option struct {
 	fileFilter    func(finfo os.FileInfo) bool
 	generatorName string
+	tagKey        string
+	buildTag      string
+	withoutHeader bool
+
+	// generatedSuffix is the suffix of the names of the generated files,
+	// which are not read, as are the files named as generatedNames.
+	generatedSuffix string
+	generatedNames  map[string]bool
+	// excludedDirs are the patterns of the directories skipped by a
+	// recursive run.
+	excludedDirs []string
+	// marker is the comment marking the structs generated for.
+	marker string
+	// defaultMarker are the options every marker takes before its own.
+	defaultMarker []string
+	// initialisms are the words, upper-cased, the generated names spell as
+	// initialisms.
+	initialisms map[string]bool
+	// jobs is the number of packages generated for at once.
+	jobs int
+
+	diagnosticsSink func(Diagnostic)
+
+	// hook is the name of the package-level function variable the
+	// constructors call with the type name, and hookType its type.
+	hook     string
+	hookType string
+
+	singleLineParams int
+	groupParams      bool
+	di               string
+
+	// files restricts the structs generated for to those declared in the
+	// files of these base names, if any.
+	files map[string]bool
+	// structs restricts the structs generated for to those whose names it
+	// matches, if set.
+	structs *regexp.Regexp
+	// subpkg is the name of the package the constructors are generated
+	// for, importing the package of the structs, if any.
+	subpkg string
+	// removeStale is called for the packages without marked structs, if
+	// set.
+	removeStale func(pkg *ast.Package) error
+	// usageGuards makes the unexported functions generated referred to by
+	// var _ = name.
+	usageGuards bool
+	// pkgPath is the import path of the package of the target directory,
+	// if it is not resolved below GOPATH/src.
+	pkgPath string
+
+	plugins []func(GenContext) ([]byte, error)
+
+	// newAssertionWriter returns the writer of the test of a package, if
+	// it is generated: asserting the field counts and calling the
+	// constructors, with assertFields and constructorTests.
+	newAssertionWriter func(pkg *ast.Package) io.Writer
+	assertFields       bool
+	constructorTests   bool
+
+	// outputPath returns the path of the generated file of a package, when
+	// packages whose file is up to date are skipped.
+	outputPath func(pkg *ast.Package) string
+	// newConstraintWriter returns the writer of the generated file of a
+	// source file with build constraints of its own, if they are written
+	// apart.
+	newConstraintWriter func(pkg *ast.Package, filename string) io.Writer
+	// removeStaleConstraintFiles is called with the files whose
+	// constructors were written apart, if set.
+	removeStaleConstraintFiles func(pkg *ast.Package, written []string) error
+
+	manifest *manifest
+	// cache records the directories whose files are unchanged, if set.
+	cache *Cache
+
+	// tmplText or tmplFile is the template of the constructors replacing
+	// the built-in one, if any, and constructorTmpl the template used.
+	tmplText        string
+	tmplFile        string
+	constructorTmpl *template.Template
 }
 
 func WithFileFilter(fileFilter func(finfo os.FileInfo) bool) Option {
@@ -51,220 +159,1624 @@ func WithFileFilter(fileFilter func(finfo os.FileInfo) bool) Option {
 	}
 }
 
+// WithGeneratedSuffix makes Run leave out the files whose names end with
+// suffix, the generated files, when reading the packages, instead of those
+// ending with _constructor_gen.go. An empty suffix reads every file.
+func WithGeneratedSuffix(suffix string) Option {
+	return func(o *option) {
+		o.generatedSuffix = suffix
+	}
+}
+
+// WithGeneratedFileName makes Run also leave out the files named name, e.g.
+// zz_generated.constructors.go, when the generated files are named so
+// rather than by their suffix.
+func WithGeneratedFileName(name string) Option {
+	return func(o *option) {
+		if o.generatedNames == nil {
+			o.generatedNames = make(map[string]bool)
+		}
+		o.generatedNames[filepath.Base(name)] = true
+	}
+}
+
 func WithGeneratorName(generatorName string) Option {
 	return func(o *option) {
 		o.generatorName = generatorName
 	}
 }
 
+// WithTagKey makes fields tagged with key, e.g. `ctor:""`, taken by the
+// constructors instead of those tagged with required.
+func WithTagKey(key string) Option {
+	return func(o *option) {
+		o.tagKey = key
+	}
+}
+
+// WithBuildTag guards the generated files with the build constraint
+// expression buildTag, e.g. "!genconstructor_off", or with constraint lines
+// of either syntax, e.g. "// +build !genconstructor_off". It is combined
+// with the constraints of the files of the structs, which the generated
+// files keep in any case.
+func WithBuildTag(buildTag string) Option {
+	return func(o *option) {
+		o.buildTag = buildTag
+	}
+}
+
+// WithoutHeader omits the "// Code generated ... DO NOT EDIT." comment
+// from the generated files. Tools, including go vet and linters, then no
+// longer recognize them as generated.
+func WithoutHeader() Option {
+	return func(o *option) {
+		o.withoutHeader = true
+	}
+}
+
+// WithHook makes every constructor call the package-level function
+// variable name with the name of the type it constructs, if it is set:
+//
+//	if onConstruct != nil {
+//		onConstruct("Foo")
+//	}
+//
+// The variable is declared as typ, "func(name string)" if empty, in the
+// generated file unless the package declares it already.
+func WithHook(name, typ string) Option {
+	return func(o *option) {
+		o.hook = name
+		o.hookType = typ
+	}
+}
+
+// WithSingleLineParams puts the parameters of constructors taking at most n
+// of them on a single line, e.g. func NewFoo(id string, name string) Foo.
+// By default each parameter is on its own line, however many there are.
+func WithSingleLineParams(n int) Option {
+	return func(o *option) {
+		o.singleLineParams = n
+	}
+}
+
+// outTmpl renders a generated file.
+var outTmpl = template.Must(template.New("out").Parse(`
+			{{ if .Header }}// Code generated by {{ .GeneratorName }}; DO NOT EDIT.{{ end }}
+
+			{{ .BuildConstraint }}
+
+			package {{ .PackageName }}
+
+			{{ .ImportPackages }}
+
+			{{ if .HookDecl }}var {{ .Hook }} {{ .HookType }}{{ end }}
+
+			{{ .Body }}
+		`))
+
+// WithGroupedParams declares consecutive parameters of the same type
+// together, as in func NewFoo(id, name string, age int) Foo.
+func WithGroupedParams() Option {
+	return func(o *option) {
+		o.groupParams = true
+	}
+}
+
+// WithMarker makes Run generate for the structs marked with the comment
+// marker, e.g. "//myco:constructor", instead of "//genconstructor". The
+// marker takes the same options.
+func WithMarker(marker string) Option {
+	return func(o *option) {
+		o.marker = marker
+	}
+}
+
+// WithDefaultMarker makes every marker take options, e.g. "-p -g", as if
+// they were written before its own.
+func WithDefaultMarker(options string) Option {
+	return func(o *option) {
+		o.defaultMarker = strings.Fields(options)
+	}
+}
+
+// WithFiles generates constructors only for the structs declared in the
+// files of the given names, e.g. os.Getenv("GOFILE"). The whole package is
+// still read. By default the structs of every file are generated for.
+func WithFiles(names ...string) Option {
+	return func(o *option) {
+		if o.files == nil {
+			o.files = make(map[string]bool, len(names))
+		}
+		for _, name := range names {
+			o.files[filepath.Base(name)] = true
+		}
+	}
+}
+
+// WithStructs generates constructors only for the marked structs whose
+// names re matches, e.g. regexp.MustCompile("^Order(Line)?$"). By default
+// every marked struct is generated for.
+func WithStructs(re *regexp.Regexp) Option {
+	return func(o *option) {
+		o.structs = re
+	}
+}
+
+// WithStaleOutput makes Run call remove for each package without marked
+// structs, or whose constructors are all written apart by
+// WithConstraintFiles, so that the file generated for it before, if any,
+// can be removed rather than left behind referring to structs which may be
+// gone. An error of remove is returned by Run.
+func WithStaleOutput(remove func(pkg *ast.Package) error) Option {
+	return func(o *option) {
+		o.removeStale = remove
+	}
+}
+
+// WithPackagePath makes Run take pkgPath as the import path of the package
+// of the target directory instead of resolving it from the directory below
+// GOPATH/src, e.g. for a package written to a scratch directory. It cannot
+// be used with a recursive run.
+func WithPackagePath(pkgPath string) Option {
+	return func(o *option) {
+		o.pkgPath = pkgPath
+	}
+}
+
 func Run(targetDir string, newWriter func(pkg *ast.Package) io.Writer, opts ...Option) error {
 	option := option{
-		generatorName: "go-genconstructor",
+		generatorName:   "go-genconstructor",
+		tagKey:          "required",
+		generatedSuffix: "_constructor_gen.go",
+		marker:          commentMarker,
 	}
 	for _, opt := range opts {
 		opt(&option)
 	}
+	// the files generated before are not read, so that their declarations
+	// are not taken for the ones of the package
+	fileFilter := func(finfo os.FileInfo) bool {
+		if option.generatedSuffix != "" && strings.HasSuffix(finfo.Name(), option.generatedSuffix) || option.generatedNames[finfo.Name()] {
+			return false
+		}
+		return option.fileFilter == nil || option.fileFilter(finfo)
+	}
 
-	walkers, err := genutil.DirToAstWalker(targetDir, option.fileFilter)
-	if err != nil {
+	var buildTag constraint.Expr
+	if option.buildTag != "" {
+		x, err := parseBuildTag(option.buildTag)
+		if err != nil {
+			return err
+		}
+		if _, err := buildConstraintLines(x); err != nil {
+			return err
+		}
+		buildTag = x
+	}
+	if !strings.HasPrefix(option.marker, "//") || len(option.marker) == 2 || len(strings.Fields(option.marker)) != 1 {
+		return fmt.Errorf("invalid marker %q, want a // comment without spaces", option.marker)
+	}
+	if strings.TrimSpace(option.tagKey) == "" || strings.ContainsAny(option.tagKey, " :\"`") {
+		return fmt.Errorf("invalid tag key %q", option.tagKey)
+	}
+	if option.hook != "" {
+		if !token.IsIdentifier(option.hook) {
+			return fmt.Errorf("invalid hook name %q", option.hook)
+		}
+		if option.hookType == "" {
+			option.hookType = "func(name string)"
+		}
+	}
+	if _, ok := diFrameworks[option.di]; option.di != "" && !ok {
+		return fmt.Errorf("unknown DI framework %q, want %q, %q or %q", option.di, DIFx, DIWire, DIDo)
+	}
+	var err error
+	if option.subpkg != "" && option.constructorTests {
+		return errors.New("the constructors of a subpackage cannot be tested by the package of the structs")
+	}
+	if option.subpkg != "" && !token.IsIdentifier(option.subpkg) {
+		return fmt.Errorf("invalid subpackage name %q", option.subpkg)
+	}
+	if option.cache != nil && option.manifest != nil {
+		return fmt.Errorf("a cache cannot be used with a manifest")
+	}
+	if option.constructorTmpl, err = parseConstructorTmpl(option.tmplText, option.tmplFile); err != nil {
 		return err
 	}
+	if len(option.initialisms) > 0 {
+		// getters and conversions are named with the initialisms as well
+		if option.constructorTmpl, err = option.constructorTmpl.Clone(); err != nil {
+			return err
+		}
+		option.constructorTmpl.Funcs(map[string]interface{}{"ToUpperCamel": option.upperCamel})
+	}
 
-	for _, walker := range walkers {
-		body := new(bytes.Buffer)
-		importPackages := make(map[string]string, 10)
+	dirs := []string{targetDir}
+	root, recursive := recursiveRoot(targetDir)
+	if recursive {
+		if option.pkgPath != "" {
+			return errors.New("a package path cannot be given for a recursive run")
+		}
+		if dirs, err = packageDirs(root, option.excludedDirs); err != nil {
+			return err
+		}
+	}
+	var diagnostics Diagnostics
+	report := func(d Diagnostic) {
+		if option.diagnosticsSink != nil {
+			option.diagnosticsSink(d)
+		}
+		if d.Severity == SeverityError {
+			diagnostics = append(diagnostics, d)
+		}
+	}
+
+	// walkers are the packages to generate for, and walkerDirs their
+	// directories
+	var walkers []genutil.AstPkgWalker
+	var walkerDirs []string
+	// cachedDirs are the directories read, whose hashes are recorded once
+	// all are generated for
+	var cachedDirs []string
+	unchanged := 0
+	for _, dir := range dirs {
+		if c := option.cache; c != nil {
+			hash, err := c.dirHash(dir, option.fileFilter)
+			if err != nil {
+				return err
+			}
+			if c.unchanged(dir, hash) {
+				report(Diagnostic{Pos: token.Position{Filename: dir}, Severity: SeverityInfo, Message: "unchanged since the cached run"})
+				unchanged++
+				continue
+			}
+			cachedDirs = append(cachedDirs, dir)
+		}
+		m, err := readPackages(dir, fileFilter, option.pkgPath)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			walkers = append(walkers, m[name])
+			walkerDirs = append(walkerDirs, dir)
+		}
+	}
+
+	switch {
+	case len(walkers) == 0 && unchanged > 0:
+	case len(walkers) == 0 && recursive:
+		report(Diagnostic{Pos: token.Position{Filename: root}, Severity: SeverityInfo, Message: "no Go packages"})
+	case len(walkers) == 0:
+		msg, err := emptyDirMessage(targetDir, fileFilter)
+		if err != nil {
+			return err
+		}
+		report(Diagnostic{Pos: token.Position{Filename: targetDir}, Severity: SeverityInfo, Message: msg})
+	}
+
+	// generatePackage generates for the package of walker in dir. It reports
+	// into res, which Run applies in the order of the packages, so that they
+	// can be generated concurrently.
+	generatePackage := func(walker genutil.AstPkgWalker, dir string, res *pkgResult) error {
+		report := res.report
+		out := new(bytes.Buffer)
+		var err error
+		if option.outputPath != nil {
+			ok, err := upToDate(walker.Pkg, option.outputPath(walker.Pkg))
+			if err != nil {
+				return err
+			}
+			if ok {
+				report(Diagnostic{Pos: token.Position{Filename: dir}, Severity: SeverityInfo, Message: fmt.Sprintf("package %s is up to date", walker.Pkg.Name)})
+				return nil
+			}
+		}
+		var specs []markedSpec
+		marked := 0
 		for _, spec := range walker.AllStructSpecs() {
 			docs := make([]*ast.Comment, 0, 10)
 			if spec.Doc != nil {
 				docs = append(docs, spec.Doc.List...)
 			}
+			// the line comment of a spec in a type ( ... ) group, e.g.
+			// Foo struct{ ... } //genconstructor, marks it as well, and
+			// the doc of the group marks all of its specs
+			if spec.Comment != nil {
+				docs = append(docs, spec.Comment.List...)
+			}
 			if decl := walker.TypeSpecToGenDecl(spec); decl.Doc != nil {
 				docs = append(docs, decl.Doc.List...)
 			}
-			if len(docs) == 0 {
+			marker, hasMarker := parseMarker(docs, option.marker, option.defaultMarker, func(comment *ast.Comment, opt string) {
+				report(Diagnostic{
+					Pos:      walker.FileSet.Position(comment.Pos()),
+					Severity: SeverityWarning,
+					Message:  fmt.Sprintf("unknown option %s", opt),
+				})
+			})
+			if !hasMarker {
 				continue
 			}
-			hasMarker := false
-			hasPointerOpts := false
-			hasSuperOpts := false
-			hasExtendsOpts := false
-			for _, comment := range docs {
-				if strings.HasPrefix(strings.TrimSpace(comment.Text), commentMarker) {
-					hasMarker = true
-					for _, s := range strings.Fields(comment.Text) {
-						if s == pointerOpts {
-							hasPointerOpts = true
-							break
-						}
-						if s == superOpts {
-							hasSuperOpts = true
-							break
-						}
-						if s == extendsOpts {
-							hasExtendsOpts = true
-							break
-						}
+			marker.accessors = hasAccessorMarker(docs)
+			marked++
+			filename := walker.FileSet.Position(spec.Pos()).Filename
+			if option.files != nil && !option.files[filepath.Base(filename)] || option.structs != nil && !option.structs.MatchString(spec.Name.Name) {
+				continue
+			}
+			specs = append(specs, markedSpec{
+				spec:       spec,
+				marker:     marker,
+				filename:   filename,
+				constraint: sourceConstraint(walker.ToFile(spec), filename),
+			})
+		}
+		switch {
+		case marked == 0:
+			report(Diagnostic{Pos: token.Position{Filename: dir}, Severity: SeverityInfo, Message: fmt.Sprintf("package %s has no marked structs", walker.Pkg.Name)})
+			if option.removeStale != nil {
+				if err := option.removeStale(walker.Pkg); err != nil {
+					return err
+				}
+			}
+			if option.removeStaleConstraintFiles != nil {
+				if err := option.removeStaleConstraintFiles(walker.Pkg, nil); err != nil {
+					return err
+				}
+			}
+		case len(specs) == 0 && option.structs != nil:
+			report(Diagnostic{Pos: token.Position{Filename: dir}, Severity: SeverityInfo, Message: fmt.Sprintf("package %s has no marked structs matching %s", walker.Pkg.Name, option.structs)})
+		case len(specs) == 0:
+			report(Diagnostic{Pos: token.Position{Filename: dir}, Severity: SeverityInfo, Message: fmt.Sprintf("package %s has no marked structs in the given files", walker.Pkg.Name)})
+		}
+		if len(specs) == 0 {
+			// e.g. the subpackage generated for a package of the tree
+			return nil
+		}
+
+		pkgName, qualifier := walker.Pkg.Name, ""
+		if option.subpkg != "" {
+			if walker.Pkg.Name == "main" || walker.Pkg.Name == option.subpkg {
+				return fmt.Errorf("cannot generate the constructors of package %s for package %s", walker.Pkg.Name, option.subpkg)
+			}
+			pkgName, qualifier = option.subpkg, walker.Pkg.Name
+		}
+
+		// the constructors of the files with constraints of their own are
+		// written apart when the constraints differ
+		pkgOut := newOutput(walker, "", option, qualifier, buildTag)
+		outputs := []*output{pkgOut}
+		fileOuts := make(map[string]*output)
+		if option.newConstraintWriter != nil {
+			for _, filename := range constrainedFiles(specs) {
+				o := newOutput(walker, filename, option, qualifier, buildTag)
+				fileOuts[filename] = o
+				outputs = append(outputs, o)
+			}
+		}
+
+		failed := false
+		var providers []provider
+		var counts []fieldCount
+		var calls []constructorCall
+		var registered []manifestEntry
+		// structs declared per build constraint are registered once
+		registeredNames := make(map[string]bool)
+		for _, s := range specs {
+			spec, marker := s.spec, s.marker
+			o, ok := fileOuts[s.filename]
+			if !ok {
+				o = pkgOut
+			}
+			if prev, ok := o.declared[spec.Name.Name]; ok {
+				report(newDiagnostic(walker.FileSet.Position(spec.Pos()), "%s is also declared at %s; structs declared per build constraint need WithConstraintFiles", spec.Name.Name, walker.FileSet.Position(prev.Pos())))
+				failed = true
+				continue
+			}
+			o.declared[spec.Name.Name] = spec
+
+			if err := generateConstructor(o.body, o.collector, spec, marker, option); err != nil {
+				var d Diagnostic
+				if !errors.As(err, &d) {
+					return err
+				}
+				report(d)
+				failed = true
+				continue
+			}
+			// the generated file keeps the build constraints of the files of
+			// the structs
+			o.constraints = append(o.constraints, s.constraint)
+			generic := spec.TypeParams != nil && len(spec.TypeParams.List) > 0
+			if option.assertFields {
+				switch {
+				case generic:
+					report(Diagnostic{
+						Pos:      walker.FileSet.Position(spec.Pos()),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("the fields of generic %s are not asserted", spec.Name.Name),
+					})
+				case o != pkgOut:
+					report(Diagnostic{
+						Pos:      walker.FileSet.Position(spec.Pos()),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("the fields of %s, declared per build constraint, are not asserted", spec.Name.Name),
+					})
+				default:
+					counts = append(counts, fieldCount{StructName: spec.Name.Name, N: numFields(spec.Type.(*ast.StructType))})
+				}
+			}
+			if option.constructorTests {
+				switch {
+				case generic:
+					report(Diagnostic{
+						Pos:      walker.FileSet.Position(spec.Pos()),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("the constructor of generic %s is not tested", spec.Name.Name),
+					})
+				case o != pkgOut:
+					report(Diagnostic{
+						Pos:      walker.FileSet.Position(spec.Pos()),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("the constructor of %s, declared per build constraint, is not tested", spec.Name.Name),
+					})
+				default:
+					calls = append(calls, o.collector.calls[spec.Name.Name])
+				}
+			}
+			if registeredNames[spec.Name.Name] {
+				continue
+			}
+			registeredNames[spec.Name.Name] = true
+			if option.manifest != nil {
+				switch name := option.constructorName(spec.Name.Name, marker); {
+				case generic:
+					report(Diagnostic{
+						Pos:      walker.FileSet.Position(spec.Pos()),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("generic %s is not registered in the manifest", spec.Name.Name),
+					})
+				case !ast.IsExported(name):
+					report(Diagnostic{
+						Pos:      walker.FileSet.Position(spec.Pos()),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("unexported %s of %s is not registered in the manifest", name, spec.Name.Name),
+					})
+				default:
+					registered = append(registered, manifestEntry{StructName: spec.Name.Name, Constructor: name})
+				}
+			}
+			if option.di != "" {
+				if generic {
+					report(Diagnostic{
+						Pos:      walker.FileSet.Position(spec.Pos()),
+						Severity: SeverityWarning,
+						Message:  fmt.Sprintf("generic %s is not registered with %s", spec.Name.Name, option.di),
+					})
+					continue
+				}
+				p := provider{constructor: option.constructorName(spec.Name.Name, marker)}
+				if marker.pair {
+					// the frameworks handle the error instead of a panic
+					p.constructor += "E"
+				}
+				if p.iface = o.collector.resultTypes[spec.Name.Name]; p.iface != "" && o != pkgOut {
+					// the file of the struct imports the package of the
+					// interface, the one of the package may not
+					if i := strings.Index(p.iface, "."); i > 0 {
+						name := p.iface[:i]
+						pkgOut.importPackages[name] = o.importPackages[name]
 					}
-					break
+				}
+				if option.di == DIDo {
+					p = provider{constructor: option.doProviderName(spec.Name.Name, marker)}
+				}
+				providers = append(providers, p)
+				switch {
+				case marker.factory && option.di == DIDo:
+					providers = append(providers, provider{constructor: option.doProviderName(spec.Name.Name+"Factory", marker)})
+				case marker.factory:
+					providers = append(providers, provider{constructor: option.factoryName(spec.Name.Name, marker)})
 				}
 			}
-			if !hasMarker {
+		}
+		if len(providers) > 0 {
+			framework := diFrameworks[option.di]
+			if decl, ok := pkgOut.collector.scope.decls[framework.varName]; ok && option.subpkg == "" {
+				report(newDiagnostic(walker.FileSet.Position(decl.pos), "%s is already declared; cannot register the constructors with %s", framework.varName, option.di))
+				failed = true
+			}
+			pkgOut.importPackages[framework.pkgName] = framework.importPath
+			pkgOut.body.WriteString("\n" + framework.decl(providers))
+		}
+		if len(counts) > 0 {
+			if decl, ok := pkgOut.collector.scope.decls[fieldAssertionTest]; ok {
+				report(newDiagnostic(walker.FileSet.Position(decl.pos), "%s is already declared; cannot assert the fields", fieldAssertionTest))
+				failed = true
+			}
+		}
+		if len(calls) > 0 {
+			if decl, ok := pkgOut.collector.scope.decls[constructorCallTest]; ok {
+				report(newDiagnostic(walker.FileSet.Position(decl.pos), "%s is already declared; cannot test the constructors", constructorCallTest))
+				failed = true
+			}
+		}
+		if failed {
+			return nil
+		}
+
+		generated := false
+		for _, o := range outputs {
+			generated = generated || o.body.Len() > 0
+		}
+		if !generated {
+			return nil
+		}
+		// the hook is declared once, by the file of the package, even if it
+		// has no constructor of its own
+		hookDecl := option.hook != "" && (option.subpkg != "" || !pkgOut.collector.scope.declares(option.hook))
+		var buildConstraint string
+		// written are the files whose constructors are written apart
+		var written []string
+		for _, o := range outputs {
+			if o.body.Len() == 0 && !(o == pkgOut && hookDecl) {
+				if o == pkgOut && option.removeStale != nil && option.files == nil && option.structs == nil {
+					// every constructor is written apart
+					if err := option.removeStale(walker.Pkg); err != nil {
+						return err
+					}
+				}
 				continue
 			}
+			if o != pkgOut {
+				written = append(written, o.filename)
+			}
+			if option.subpkg != "" && o.body.Len() > 0 {
+				if importPath, ok := o.importPackages[walker.Pkg.Name]; ok && importPath != walker.PkgPath {
+					return fmt.Errorf("package %s of package %s is imported by the same name", importPath, walker.Pkg.Name)
+				}
+				o.importPackages[walker.Pkg.Name] = walker.PkgPath
+			}
 
-			structType := spec.Type.(*ast.StructType)
+			var lines string
+			if x := andConstraints(o.constraints); x != nil {
+				if lines, err = buildConstraintLines(x); err != nil {
+					return err
+				}
+			}
+			var writer io.Writer
+			if o == pkgOut {
+				buildConstraint = lines
+				writer = newWriter(walker.Pkg)
+			} else {
+				writer = option.newConstraintWriter(walker.Pkg, o.filename)
+			}
+			if err := writeFile(out, outTmpl, map[string]interface{}{
+				"Header":          !option.withoutHeader,
+				"GeneratorName":   option.generatorName,
+				"BuildConstraint": lines,
+				"PackageName":     pkgName,
+				"ImportPackages":  fmtImports(o.importPackages, walker.PkgPath),
+				"Hook":            option.hook,
+				"HookType":        option.hookType,
+				"HookDecl":        o == pkgOut && hookDecl,
+				"Body":            o.body.String(),
+			}, writer); err != nil {
+				return err
+			}
+		}
+		if option.removeStaleConstraintFiles != nil && option.files == nil && option.structs == nil {
+			if err := option.removeStaleConstraintFiles(walker.Pkg, written); err != nil {
+				return err
+			}
+		}
 
-			var superName string
-			fieldInfos := make([]FieldInfo, 0, len(structType.Fields.List))
-			for _, field := range structType.Fields.List {
-				if field.Tag == nil {
-					continue
+		if option.manifest != nil && len(registered) > 0 {
+			switch {
+			case option.subpkg == "" && walker.Pkg.Name == "main":
+				report(Diagnostic{Pos: token.Position{Filename: dir}, Severity: SeverityWarning, Message: "the constructors of package main cannot be imported by the manifest"})
+			case option.subpkg != "":
+				res.manifest = append(res.manifest, manifestAdd{walker.PkgPath + "/" + option.subpkg, option.subpkg, registered, andConstraints(pkgOut.constraints)})
+			default:
+				res.manifest = append(res.manifest, manifestAdd{walker.PkgPath, walker.Pkg.Name, registered, andConstraints(pkgOut.constraints)})
+			}
+		}
+
+		if len(counts) == 0 && len(calls) == 0 {
+			return nil
+		}
+		imports, err := testImports(counts, calls, pkgOut.importPackages, walker.PkgPath)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(out, assertionTmpl, map[string]interface{}{
+			"Header":          !option.withoutHeader,
+			"GeneratorName":   option.generatorName,
+			"BuildConstraint": buildConstraint,
+			"PackageName":     walker.Pkg.Name,
+			"Imports":         imports,
+			"TestName":        fieldAssertionTest,
+			"Counts":          counts,
+			"CallTestName":    constructorCallTest,
+			"Calls":           calls,
+		}, option.newAssertionWriter(walker.Pkg)); err != nil {
+			return err
+		}
+		return nil
+	}
+	err = forEachPackage(len(walkers), option.jobs, func(i int, res *pkgResult) error {
+		return generatePackage(walkers[i], walkerDirs[i], res)
+	}, func(res *pkgResult) {
+		for _, d := range res.diagnostics {
+			report(d)
+		}
+		for _, m := range res.manifest {
+			option.manifest.add(m.pkgPath, m.pkgName, m.entries, m.expr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	out := new(bytes.Buffer)
+	if m := option.manifest; m != nil && len(m.entries) > 0 {
+		var buildConstraint string
+		if x := andConstraints(m.constraints); x != nil {
+			if buildConstraint, err = buildConstraintLines(x); err != nil {
+				return err
+			}
+		}
+		data := m.file()
+		data["Header"] = !option.withoutHeader
+		data["GeneratorName"] = option.generatorName
+		data["BuildConstraint"] = buildConstraint
+		if err := writeFile(out, manifestTmpl, data, m.newWriter()); err != nil {
+			return err
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		return diagnostics
+	}
+	if c := option.cache; c != nil {
+		// the directories are hashed with the files just generated, so
+		// that removing or editing one of them regenerates it
+		for _, dir := range cachedDirs {
+			hash, err := c.dirHash(dir, option.fileFilter)
+			if err != nil {
+				return err
+			}
+			c.record(dir, hash)
+		}
+	}
+	return nil
+}
+
+// constructorTmpl renders a constructor from a tmplParam.
+var constructorTmpl = template.Must(template.New("constructor").Funcs(map[string]interface{}{
+	"ToUpperCamel": func(s string) string { return upperCamel(s, nil) },
+	"ToLowerCamel": lowerCamel,
+	"HasPrefix":    strings.HasPrefix,
+	"TrimPrefix":   strings.TrimPrefix,
+}).Parse(`
+{{ define "flattened" -}}
+	{{ if HasPrefix .Type "*" }}&{{ end }}{{ TrimPrefix .Type "*" }}{
+		{{- range .Fields }}
+			{{- if .Derived }}
+			{{- else if .Flattened }}
+				{{ .Name }}: {{ template "flattened" . }},
+			{{- else if .ConstValue }}
+				{{ .Name }}: {{ .ConstValue }},
+			{{- else }}
+				{{ .Name }}: {{ .Arg }},
+			{{- end }}
+		{{- end }}
+	}
+{{- end }}
+
+{{ define "result" -}}
+	{{ if .ReturnType }}{{ .ReturnType }}{{ else }}{{ if .Pointer }}*{{ end }}{{ if or (.Super) (.Extends) }}{{ .InterfaceName }}{{ else }}{{ .StructType }}{{ .TypeArgs }}{{ end }}{{ end }}
+{{- end }}
+
+{{ define "params" -}}
+	{{- if .SingleLine }}
+		{{- range $i, $d := .ParamDecls }}{{ if $i }}, {{ end }}{{ $d }}{{ end }}
+	{{- else }}
+		{{- range .ParamDecls }}
+			{{ . }},
+		{{- end }}
+	{{ end -}}
+{{- end }}
+
+func {{ .FuncName }}{{ if .Pair }}E{{ end }}{{ .TypeParams }}({{ template "params" . }}) {{ if .ReturnsError }}({{ if .NamedReturn }}{{ .ResultName }} {{ end }}{{ template "result" . }}, {{ if .NamedReturn }}err {{ end }}error){{ else }}{{ if .NamedReturn }}({{ .ResultName }} {{ end }}{{ template "result" . }}{{ if .NamedReturn }}){{ end }}{{ end }} {
+					{{- if .Hook }}
+					if {{ .Hook }} != nil {
+						{{ .Hook }}("{{ .StructName }}")
+					}
+					{{- end }}
+					{{- range .Params }}
+						{{- if .NopDefault }}
+							if {{ .ParamName }} == nil {
+								{{ .ParamName }} = {{ .NopDefault }}
+							}
+						{{- end }}
+					{{- end }}
+					{{- range .NilChecks }}
+					if {{ . }} == nil {
+						{{- if $.NilCheckError }}
+						var zero {{ template "result" $ }}
+						return zero, errors.New("{{ $.FuncName }}: {{ . }} must not be nil")
+						{{- else }}
+						panic("{{ $.FuncName }}: {{ . }} must not be nil")
+						{{- end }}
+					}
+					{{- end }}
+					{{ if .ResultName }}{{ .ResultName }} {{ if .NamedReturn }}={{ else }}:={{ end }} {{ else }}return {{ end }}{{ if or (.Pointer) (.Super) (.Extends) }}&{{ end }}{{ .StructType }}{{ .TypeArgs }}{
+						{{- range .Fields }}
+							{{- if .Derived }}
+							{{- else if .Flattened }}
+								{{ .Name }}: {{ template "flattened" . }},
+							{{- else if .ConstValue }}
+								{{ .Name }}: {{ .ConstValue }},
+							{{- else }}
+								{{ .Name }}: {{ if and ($.Extends) (eq (ToUpperCamel .Name) $.InterfaceName) }}x.(*{{ .Name }}){{ else }}{{ .Arg }}{{ end }},
+							{{- end }}
+						{{- end }}
+					}
+					{{- if .Options }}
+					for _, opt := range opts {
+						opt({{ if not .Pointer }}&{{ end }}{{ .ResultName }})
+					}
+					{{- end }}
+					{{- range .Derived }}
+					{{ $.ResultName }}.{{ .Target }} = {{ .Value }}
+					{{- end }}
+					{{- if .ReturnsError }}
+					{{- range .Validators }}
+					if err := {{ $.ResultName }}.{{ . }}(); err != nil {
+						var zero {{ template "result" $ }}
+						return zero, err
+					}
+					{{- end }}
+					return {{ .ResultName }}, nil
+					{{- else if .ResultName }}
+					return {{ .ResultName }}
+					{{- end }}
+				}
+				{{- if .ReturnsError }}
+
+				func {{ if .Pair }}{{ .FuncName }}{{ else }}{{ .MustName }}{{ end }}{{ .TypeParams }}({{ template "params" . }}) {{ template "result" . }} {
+					{{ .ResultName }}, err := {{ .FuncName }}{{ if .Pair }}E{{ end }}{{ .TypeArgs }}({{ range $i, $a := .ParamArgs }}{{ if $i }}, {{ end }}{{ $a }}{{ end }})
+					if err != nil {
+						panic(err)
+					}
+					return {{ .ResultName }}
 				}
-				tag := reflect.StructTag(strings.Trim(field.Tag.Value, "`"))
+				{{- end }}
+				{{- with .Options }}
 
-				constValue, hasRequiredTag := tag.Lookup("required")
+				type {{ .TypeName }}{{ $.TypeParams }} func(*{{ $.StructType }}{{ $.TypeArgs }})
+				{{- range .Funcs }}
 
-				_, hasSuperTag := tag.Lookup("super")
-				if !hasRequiredTag && !hasSuperTag {
-					continue
+				func {{ .Name }}{{ $.TypeParams }}({{ .Field.ParamName }} {{ .Field.Type }}) {{ $.Options.TypeName }}{{ $.TypeArgs }} {
+					return func(x *{{ $.StructType }}{{ $.TypeArgs }}) {
+						x.{{ .Field.Name }} = {{ .Field.ParamName }}
+					}
 				}
+				{{- end }}
+				{{- end }}
+				{{- with .From }}
 
-				fieldName := genutil.ParseFieldName(field)
-				typePrinter, err := walker.ToTypePrinter(field.Type)
-				if err != nil {
-					return err
+				func {{ $.FuncName }}From{{ ToUpperCamel .Type }}{{ $.TypeParams }}({{ .Name }} {{ .Type }}{{ range .Params }}, {{ . }}{{ end }}) {{ if and $.ReturnsError (not $.Pair) }}({{ template "result" $ }}, error){{ else }}{{ template "result" $ }}{{ end }} {
+					return {{ $.FuncName }}{{ $.TypeArgs }}({{ range $i, $a := .Args }}{{ if $i }}, {{ end }}{{ $a }}{{ end }})
 				}
+				{{- end }}
+				{{- with .Factory }}
 
-				fieldInfos = append(fieldInfos, FieldInfo{
-					Type:       typePrinter.Print(walker.PkgPath),
-					Name:       fieldName,
-					ConstValue: constValue,
-				})
+				type {{ .TypeName }}{{ $.TypeParams }} struct {
+					{{- range .Deps }}
+					{{ .ParamName }} {{ .Type }}
+					{{- end }}
+				}
 
-				if hasSuperTag {
-					superName = fieldName
+				func {{ .FuncName }}{{ $.TypeParams }}({{ range $i, $f := .Deps }}{{ if $i }}, {{ end }}{{ .ParamName }} {{ .Type }}{{ end }}) *{{ .TypeName }}{{ $.TypeArgs }} {
+					return &{{ .TypeName }}{{ $.TypeArgs }}{
+						{{- range .Deps }}
+						{{ .ParamName }}: {{ .ParamName }},
+						{{- end }}
+					}
 				}
 
-				// resolve imports
-				if constValue != "" {
-					ss := strings.FieldsFunc(constValue, func(c rune) bool {
-						return !unicode.IsLetter(c) && c != '.' && c != '_' && c != '-'
-					})
-					for _, s := range ss {
-						p, err := genutil.ToTypePrinter(
-							genutil.AstFileToImportMap(walker.ToFile(field)),
-							walker.PkgPath,
-							s,
-						)
-						if err != nil {
-							return err
-						}
-						for n, pkg := range p.ImportPkgMap(walker.PkgPath) {
-							importPackages[n] = pkg
-						}
+				func ({{ .Receiver }} *{{ .TypeName }}{{ $.TypeArgs }}) Create({{ range $i, $d := .Params }}{{ if $i }}, {{ end }}{{ $d }}{{ end }}) {{ if and $.ReturnsError (not $.Pair) }}({{ template "result" $ }}, error){{ else }}{{ template "result" $ }}{{ end }} {
+					return {{ $.FuncName }}{{ $.TypeArgs }}({{ range $i, $a := .Args }}{{ if $i }}, {{ end }}{{ $a }}{{ end }})
+				}
+				{{- end }}
+				{{- with .DoProvider }}
+
+				func {{ .Name }}({{ .Injector }} *do.Injector) ({{ template "result" $ }}, error) {
+					{{- range .Invokes }}
+					{{ .Name }}, err := do.Invoke[{{ .Type }}]({{ $.DoProvider.Injector }})
+					if err != nil {
+						return {{ $.DoProvider.Zero }}, err
 					}
-					continue
+					{{- end }}
+					return {{ .Constructor }}({{ range $i, $a := .Args }}{{ if $i }}, {{ end }}{{ $a }}{{ end }}){{ if not .ReturnsError }}, nil{{ end }}
 				}
+				{{- end }}
+				{{- with $d := .DoFactoryProvider }}
 
-				for n, pkg := range typePrinter.ImportPkgMap(walker.PkgPath) {
-					importPackages[n] = pkg
+				func {{ .Name }}({{ .Injector }} *do.Injector) ({{ .Result }}, error) {
+					{{- range .Invokes }}
+					{{ .Name }}, err := do.Invoke[{{ .Type }}]({{ $d.Injector }})
+					if err != nil {
+						return nil, err
+					}
+					{{- end }}
+					return {{ .Constructor }}({{ range $i, $a := .Args }}{{ if $i }}, {{ end }}{{ $a }}{{ end }}), nil
 				}
-			}
+				{{- end }}
+				{{- with .Reconstruct }}
+
+				func {{ .Name }}{{ $.TypeParams }}({{ range $i, $f := .Fields }}{{ if $i }}, {{ end }}{{ .ParamName }} {{ .Type }}{{ end }}) {{ if $.Pointer }}*{{ end }}{{ $.StructType }}{{ $.TypeArgs }} {
+					return {{ if $.Pointer }}&{{ end }}{{ $.StructType }}{{ $.TypeArgs }}{
+						{{- range .Fields }}
+						{{ .Name }}: {{ .ParamName }},
+						{{- end }}
+					}
+				}
+				{{- end }}
+				{{- if .ValidateMethod }}
+
+				func (x {{ .StructName }}{{ .TypeArgs }}) Validate() error {
+					{{- range .Checks }}
+					if x.{{ .Selector }} == {{ .Zero }} {
+						return errors.New("{{ $.StructName }}.{{ .Selector }} must not be {{ .Desc }}")
+					}
+					{{- end }}
+					{{- range .Groups }}
+					if !({{ range $i, $m := .Members }}{{ if $i }} && {{ end }}x.{{ .Selector }} == {{ .Zero }}{{ end }}) &&
+						!({{ range $i, $m := .Members }}{{ if $i }} && {{ end }}x.{{ .Selector }} != {{ .Zero }}{{ end }}) {
+						return errors.New("{{ $.StructName }}: {{ .Fields }} of group {{ .Name }} must be set together or not at all")
+					}
+					{{- end }}
+					return nil
+				}
+				{{- end }}
+				{{- range .Fields }}
+				{{- if .GenGetter }}
+
+				func (x {{ $.StructName }}{{ $.TypeArgs }}) {{ ToUpperCamel .Name }}() {{ .Type }} {
+					return x.{{ .Name }}
+				}
+				{{- end }}
+				{{- end }}
+				{{- with .Guards }}
+				{{- if eq (len .) 1 }}
+
+				var _ = {{ index . 0 }}
+				{{- else }}
+
+				var (
+					{{- range . }}
+					_ = {{ . }}
+					{{- end }}
+				)
+				{{- end }}
+				{{- end }}
+			`))
+
+// WithTemplate replaces the template of the constructors with text, a
+// text/template executed for each marked struct with the data of the
+// built-in one: .StructName, .TypeParams, .Params and .Fields, .Checks with
+// -validate-method and so on. The templates it defines can be used, such
+// as {{ template "params" . }} for the parameter declarations and
+// {{ template "result" . }} for the result type. The imports of the field
+// types are resolved and the output is formatted as with the built-in
+// template.
+func WithTemplate(text string) Option {
+	return func(o *option) {
+		o.tmplText, o.tmplFile = text, ""
+	}
+}
+
+// WithTemplateFile is WithTemplate with the template read from the file at
+// path.
+func WithTemplateFile(path string) Option {
+	return func(o *option) {
+		o.tmplText, o.tmplFile = "", path
+	}
+}
+
+// parseConstructorTmpl returns the built-in constructor template with its
+// body replaced with text, or with the contents of the file at path, if
+// either is given.
+func parseConstructorTmpl(text, path string) (*template.Template, error) {
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	if text == "" {
+		return constructorTmpl, nil
+	}
+	tmpl, err := constructorTmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if tmpl, err = tmpl.Parse(text); err != nil {
+		return nil, fmt.Errorf("invalid constructor template: %v", err)
+	}
+	return tmpl, nil
+}
 
-			var interfaceName string
-			if hasSuperOpts {
-				interfaceName = strcase.ToUpperCamel(spec.Name.Name)
+// writeFile renders tmpl with data into buf, formats it and writes it into
+// w, closing w if it is an io.Closer even if that fails, and returning its
+// error too.
+func writeFile(buf *bytes.Buffer, tmpl *template.Template, data map[string]interface{}, w io.Writer) (err error) {
+	if closer, ok := w.(io.Closer); ok {
+		defer func() {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
 			}
-			if hasExtendsOpts {
-				matched := match(strcase.SplitIntoWords(strcase.ToUpperCamel(superName)), strcase.SplitIntoWords(strcase.ToUpperCamel(spec.Name.Name)))
-				interfaceName = strings.Join(matched, "")
+		}()
+	}
+	buf.Reset()
+	if err := tmpl.Execute(buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// readPackages reads the packages of dir as genutil.DirToAstWalker does,
+// with their import path pkgPath if it is not empty.
+func readPackages(dir string, fileFilter func(finfo os.FileInfo) bool, pkgPath string) (map[string]genutil.AstPkgWalker, error) {
+	if pkgPath == "" {
+		return genutil.DirToAstWalker(dir, fileFilter)
+	}
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, fileFilter, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]genutil.AstPkgWalker, len(pkgs))
+	for name, pkg := range pkgs {
+		m[name] = genutil.AstPkgWalker{
+			FileSet: fset,
+			Pkg:     pkg,
+			Files:   genutil.ToSortedFileListFromFileMapOfAst(pkg.Files),
+			Decls:   genutil.AllDeclsFromAstPkg(pkg),
+			PkgPath: pkgPath,
+		}
+	}
+	return m, nil
+}
+
+// emptyDirMessage tells why no package was read from dir: it has no Go
+// files, or fileFilter filtered out all of them.
+func emptyDirMessage(dir string, fileFilter func(finfo os.FileInfo) bool) (string, error) {
+	finfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	goFiles := 0
+	for _, finfo := range finfos {
+		if !finfo.IsDir() && strings.HasSuffix(finfo.Name(), ".go") {
+			goFiles++
+		}
+	}
+	if goFiles == 0 {
+		return "no Go files", nil
+	}
+	return fmt.Sprintf("all %d Go files are filtered out", goFiles), nil
+}
+
+// generateConstructor writes the constructor of the struct spec marked with
+// marker into w, following the hook and parameter layout options of opt.
+func generateConstructor(w io.Writer, collector *fieldCollector, spec *ast.TypeSpec, marker markerOptions, opt option) error {
+	hook := opt.hook
+	structType := spec.Type.(*ast.StructType)
+
+	typeParams, typeArgs, err := collector.typeParams(spec)
+	if err != nil {
+		return err
+	}
+
+	collector.flatten = marker.flatten
+	collector.getters = marker.getters
+	collector.accessors = marker.accessors
+	collector.proto = marker.proto
+	collector.all = marker.all
+	collector.copy = marker.copy
+	collector.factory = marker.factory
+	fieldInfos, superName, err := collector.collect(spec.Name.Name, structType)
+	if err != nil {
+		return err
+	}
+	if err := assignParamNames(collector.walker.FileSet, fieldInfos); err != nil {
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+	}
+
+	if collector.qualifier != "" {
+		if err := checkSubpackage(collector, marker, fieldInfos, opt.subpkg); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+	}
+
+	params := paramFields(fieldInfos)
+	if err := orderParams(params); err != nil {
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+	}
+
+	if hook != "" {
+		for _, f := range params {
+			if f.ParamName == hook {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: parameter %s shadows the hook", spec.Name.Name, hook)
 			}
+		}
+	}
 
-			if err := template.Must(template.New("constructor").Funcs(map[string]interface{}{
-				"ToUpperCamel": strcase.ToUpperCamel,
-				"ToLowerCamel": strcase.ToLowerCamel,
-			}).Parse(`
-func New{{ ToUpperCamel .StructName }}(
-							{{- range .Fields }}
-								{{- if not .ConstValue }}
-									{{ if and ($.Extends) (eq (ToUpperCamel .Name) $.InterfaceName) }}x {{ $.InterfaceName }}{{ else }}{{ ToLowerCamel .Name }} {{ .Type }}{{ end }},
-								{{- end }}
-							{{- end }}
-						) {{ if .Pointer }}*{{ end }}{{ if or (.Super) (.Extends) }}{{ .InterfaceName }}{{ else }}{{ .StructName }}{{ end }} {
-							return {{ if or (.Pointer) (.Super) (.Extends) }}&{{ end }}{{ .StructName }}{
-								{{- range .Fields }}
-									{{- if .ConstValue }}
-										{{ .Name }}: {{ .ConstValue }},
-									{{- else }}
-										{{ .Name }}: {{ if and ($.Extends) (eq (ToUpperCamel .Name) $.InterfaceName) }}x.(*{{ .Name }}){{ else }}{{ ToLowerCamel .Name }}{{ end }},
-									{{- end }}
-								{{- end }}
-							}
-						}
-					`)).Execute(body, tmplParam{
-				StructName:    spec.Name.Name,
-				InterfaceName: interfaceName,
-				Fields:        fieldInfos,
-				Pointer:       hasPointerOpts,
-				Super:         hasSuperOpts,
-				Extends:       hasExtendsOpts,
-			}); err != nil {
-				return err
+	var interfaceName string
+	if marker.super {
+		interfaceName = upperCamel(spec.Name.Name, nil)
+	}
+	if marker.extends {
+		matched := match(strcase.SplitIntoWords(strcase.ToUpperCamel(superName)), strcase.SplitIntoWords(strcase.ToUpperCamel(spec.Name.Name)))
+		interfaceName = strings.Join(matched, "")
+	}
+
+	if marker.pair && marker.namedReturn {
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -pair cannot be used with -named-return", spec.Name.Name)
+	}
+	if marker.nilCheck != "" && marker.nilCheck != "panic" && marker.nilCheck != "error" {
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -nilcheck needs panic or error, not %q", spec.Name.Name, marker.nilCheck)
+	}
+	if marker.returnsError && marker.namedReturn {
+		// the error is named err next to the struct
+		for _, f := range paramFields(fieldInfos) {
+			if f.ParamName == "err" {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: parameter err of field %s collides with the error of -named-return", spec.Name.Name, f.Name)
 			}
 		}
-		if body.Len() == 0 {
-			continue
+	}
+	var validators []string
+	if marker.returnsError {
+		if marker.validateMethod {
+			validators = append(validators, "Validate")
+		}
+		if m := marker.errorMethod; m != "" {
+			if !token.IsIdentifier(m) {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: invalid method name %q", spec.Name.Name, m)
+			}
+			if !declaresMethod(collector.walker.Pkg, spec.Name.Name, m) {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: method %s of %s is not declared", spec.Name.Name, m, spec.Name.Name)
+			}
+			if collector.qualifier != "" && !ast.IsExported(m) {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: method %s is not exported and cannot be called from package %s", spec.Name.Name, m, opt.subpkg)
+			}
+			validators = append(validators, m)
 		}
+	}
 
-		out := new(bytes.Buffer)
+	if marker.name != "" && !token.IsIdentifier(marker.name) {
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: invalid constructor name %q", spec.Name.Name, marker.name)
+	}
+	if marker.name != "" && marker.unexported {
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -unexported cannot be used with -name", spec.Name.Name)
+	}
+	if err := collector.declareConstructor(spec.Name.Name, opt.constructorName(spec.Name.Name, marker)); err != nil {
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+	}
 
-		err = template.Must(template.New("out").Parse(`
-			// Code generated by {{ .GeneratorName }}; DO NOT EDIT.
+	if marker.returnType != "" {
+		switch {
+		case marker.super || marker.extends:
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -return cannot be used with -s or -e", spec.Name.Name)
+		case marker.namedReturn:
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -return cannot be used with -named-return", spec.Name.Name)
+		}
+		if marker.returnType, err = collector.resolveTypeName(spec, marker.returnType); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+		if marker.returnType, err = collector.qualify(marker.returnType); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+	}
 
-			package {{ .PackageName }}
+	var from *fromMapping
+	if marker.from != "" {
+		if marker.super || marker.extends {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -from cannot be used with -s or -e", spec.Name.Name)
+		}
+		if from, err = collector.fromMapping(marker.from, params); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+	}
 
-			{{ .ImportPackages }}
+	var reconstruct *reconstructor
+	if marker.reconstruct {
+		switch {
+		case marker.super || marker.extends:
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -reconstruct cannot be used with -s or -e", spec.Name.Name)
+		case marker.proto:
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -reconstruct cannot be used with -proto", spec.Name.Name)
+		}
+		name := opt.reconstructorName(spec.Name.Name, marker)
+		if err := collector.declareConstructor(spec.Name.Name, name); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+		if reconstruct, err = collector.reconstructor(name, structType); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+		if collector.qualifier != "" {
+			if err := checkSubpackageFields(reconstruct.Fields, opt.subpkg); err != nil {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+			}
+			if err := collector.qualifyFields(reconstruct.Fields); err != nil {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+			}
+		}
+	}
 
-			{{ .Body }}
-		`)).Execute(out, map[string]string{
-			"GeneratorName":  option.generatorName,
-			"PackageName":    walker.Pkg.Name,
-			"ImportPackages": genutil.GoFmtImports(importPackages),
-			"Body":           body.String(),
-		})
-		if err != nil {
+	var options *optionSet
+	if marker.options {
+		if marker.super || marker.extends {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: -options cannot be used with -s or -e", spec.Name.Name)
+		}
+		for _, f := range params {
+			if f.ParamName == optionsParam {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: parameter %s collides with the options", spec.Name.Name, optionsParam)
+			}
+		}
+		if options, err = collector.options(spec.Name.Name, structType, fieldInfos); err != nil {
 			return err
 		}
+		if collector.qualifier != "" {
+			fields := options.optionFields()
+			if err := checkSubpackageFields(fields, opt.subpkg); err != nil {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+			}
+			if err := collector.qualifyFields(fields); err != nil {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+			}
+			for i := range fields {
+				options.Funcs[i].Field = fields[i]
+			}
+		}
+	}
 
-		str, err := format.Source(out.Bytes())
-		if err != nil {
-			return err
+	resultName := toResultName(spec.Name.Name, fieldInfos)
+	if err := deferSiblingRefs(fieldInfos, resultName, fileImports(collector.walker.ToFile(spec))); err != nil {
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+	}
+	derived := derivedAssignments(fieldInfos, nil)
+	if !marker.namedReturn && !marker.returnsError && len(derived) == 0 && options == nil {
+		resultName = ""
+	}
+
+	checks := validationChecks(fieldInfos, nil)
+	groups := groupChecks(fieldInfos)
+	for _, g := range groups {
+		if len(g.Members) < 2 {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: group %s has a single field", spec.Name.Name, g.Name)
 		}
-		writer := newWriter(walker.Pkg)
-		if closer, ok := writer.(io.Closer); ok {
-			defer closer.Close()
+	}
+	if !marker.validateMethod {
+		for _, c := range checks {
+			if c.Zero != "nil" {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: nonzero fields are checked by Validate and need -validate-method", spec.Name.Name)
+			}
 		}
-		if _, err := writer.Write(str); err != nil {
-			return err
+		if len(groups) > 0 {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: groups are checked by Validate and need -validate-method", spec.Name.Name)
+		}
+		checks = nil
+	}
+	var nilChecks []FieldInfo
+	if marker.nilCheck != "" {
+		for _, f := range params {
+			// nil parameters with a nopdefault are replaced
+			if f.Nilable && f.NopDefault == "" {
+				nilChecks = append(nilChecks, f)
+			}
+		}
+	}
+	if len(checks) > 0 || len(groups) > 0 || (marker.nilCheck == "error" && len(nilChecks) > 0) {
+		collector.addImport("errors", "errors")
+	}
+
+	typeName := spec.Name.Name
+	if collector.qualifier != "" {
+		typeName = collector.qualifier + "." + typeName
+	}
+	p := tmplParam{
+		StructName:    spec.Name.Name,
+		FuncName:      opt.constructorName(spec.Name.Name, marker),
+		MustName:      mustName(opt.constructorName(spec.Name.Name, marker)),
+		StructType:    typeName,
+		TypeParams:    typeParams,
+		TypeArgs:      typeArgs,
+		InterfaceName: interfaceName,
+		Fields:        fieldInfos,
+		Pointer:       marker.pointer,
+		Super:         marker.super,
+		Extends:       marker.extends,
+		NamedReturn:   marker.namedReturn,
+		ResultName:    resultName,
+		Derived:       derived,
+		Hook:          hook,
+		ReturnType:    marker.returnType,
+		From:          from,
+		Reconstruct:   reconstruct,
+		Params:        params,
+		SingleLine:    len(params) <= opt.singleLineParams,
+
+		ValidateMethod: marker.validateMethod,
+		Checks:         checks,
+		Groups:         groups,
+		Pair:           marker.pair,
+		ReturnsError:   marker.returnsError,
+		Validators:     validators,
+		NilCheckError:  marker.nilCheck == "error",
+		Options:        options,
+	}
+	p.ParamDecls = p.paramDecls(opt.groupParams)
+	p.ParamArgs = p.paramArgs()
+	for _, f := range nilChecks {
+		name, _ := p.param(f)
+		p.NilChecks = append(p.NilChecks, name)
+	}
+	if options != nil {
+		p.ParamDecls = append(p.ParamDecls, optionsParam+" ..."+options.TypeName+typeArgs)
+		p.ParamArgs = append(p.ParamArgs, optionsParam+"...")
+		if err := collector.declareOptions(spec.Name.Name, options); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+	}
+	if marker.factory {
+		if p.Factory, err = p.factory(opt.factoryName(spec.Name.Name, marker)); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+		if err := collector.declareFactory(spec.Name.Name, p.Factory); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+	}
+	if opt.constructorTests {
+		collector.recordCall(spec.Name.Name, p.constructorCall())
+	}
+	if opt.di == DIDo && typeParams == "" {
+		name := opt.doProviderName(spec.Name.Name, marker)
+		if err := collector.declareConstructor(spec.Name.Name, name); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+		if p.DoProvider, err = p.doProvider(name); err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+		}
+		if p.Factory != nil {
+			name := opt.doProviderName(p.Factory.TypeName, marker)
+			if err := collector.declareConstructor(spec.Name.Name, name); err != nil {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+			}
+			if p.DoFactoryProvider, err = p.doFactoryProvider(name); err != nil {
+				return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+			}
 		}
+		framework := diFrameworks[DIDo]
+		collector.addImport(framework.pkgName, framework.importPath)
+	}
+	if opt.usageGuards {
+		p.Guards = opt.guards(p)
 	}
+	switch {
+	case p.ReturnType != "":
+		collector.recordResultType(spec.Name.Name, p.ReturnType)
+	case p.Super || p.Extends:
+		collector.recordResultType(spec.Name.Name, p.InterfaceName)
+	}
+	if err := opt.constructorTmpl.Execute(w, p); err != nil {
+		return err
+	}
+	for _, plugin := range opt.plugins {
+		code, err := plugin(p.genContext(collector))
+		if err != nil {
+			return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: plugin: %v", spec.Name.Name, err)
+		}
+		if len(code) > 0 {
+			fmt.Fprintf(w, "\n%s\n", code)
+		}
+	}
+	if err := collector.importErr; err != nil {
+		collector.importErr = nil
+		return newDiagnostic(collector.walker.FileSet.Position(spec.Pos()), "%s: %v", spec.Name.Name, err)
+	}
+	return nil
+}
+
+// constructorName returns the name of the constructor of the struct
+// structName: the one given by -name, or NewStructName, newStructName with
+// -unexported.
+func (o option) constructorName(structName string, marker markerOptions) string {
+	switch {
+	case marker.name != "":
+		return marker.name
+	case marker.unexported:
+		return "new" + o.upperCamel(structName)
+	}
+	return "New" + o.upperCamel(structName)
+}
+
+// upperCamel is upperCamel spelling the initialisms of o.
+func (o option) upperCamel(s string) string {
+	return upperCamel(s, o.initialisms)
+}
+
+// mustName returns the name of the function panicking on the error of the
+// constructor name, exported as the constructor is.
+func mustName(name string) string {
+	if ast.IsExported(name) {
+		return "Must" + name
+	}
+	return "must" + upperCamel(name, nil)
+}
 
+// declareConstructor returns an error if the constructor name is generated
+// for another struct, and records it otherwise.
+func (c *fieldCollector) declareConstructor(structName, name string) error {
+	if c.constructorNames == nil {
+		c.constructorNames = make(map[string]string)
+	}
+	if other, ok := c.constructorNames[name]; ok {
+		return fmt.Errorf("constructor %s is also generated for %s", name, other)
+	}
+	c.constructorNames[name] = structName
 	return nil
 }
 
 type tmplParam struct {
-	StructName    string
+	StructName string
+	// FuncName is the name of the constructor, NewStructName unless
+	// renamed by -name or -unexported, and MustName the one of the function
+	// panicking on its error.
+	FuncName string
+	MustName string
+	// StructType is StructName qualified with the package of the struct
+	// when the constructor is generated for another package.
+	StructType    string
 	InterfaceName string
 	Fields        []FieldInfo
 	Pointer       bool
 	Super         bool
 	Extends       bool
+	NamedReturn   bool
+	// ResultName is the name of the variable the struct is built into before
+	// it is returned, if any.
+	ResultName string
+	Derived    []assignment
+	// Params are the fields taken as constructor parameters, including the
+	// ones of flattened embedded structs, in parameter order.
+	Params []FieldInfo
+	// TypeParams and TypeArgs are the type parameter list of a generic
+	// struct and the type arguments instantiating it with them, such as
+	// "[K comparable, V any]" and "[K, V]".
+	TypeParams string
+	TypeArgs   string
+	// Hook is the function variable called with StructName first, if any.
+	Hook string
+	// SingleLine puts the parameters on the line of the function name
+	// instead of one per line.
+	SingleLine bool
+	// ReturnType is the type the constructor returns the struct as instead
+	// of the struct type, if any.
+	ReturnType string
+	// From is the conversion constructor generated as well, if any.
+	From *fromMapping
+	// Reconstruct is the function setting every field as is (-reconstruct),
+	// if any.
+	Reconstruct *reconstructor
+	// Factory is the factory holding the dependencies of the constructor
+	// (-factory), if any.
+	Factory *factory
+	// DoProvider is the provider of the constructor for do (DIDo), if any,
+	// and DoFactoryProvider the one of the constructor of Factory.
+	DoProvider        *doProvider
+	DoFactoryProvider *doProvider
+	// ParamDecls are the declarations of Params, such as "id string" or
+	// "id, name string" when they are grouped.
+	ParamDecls []string
+
+	// ValidateMethod makes a Validate method running Checks generated as
+	// well.
+	ValidateMethod bool
+	Checks         []check
+	Groups         []groupCheck
+
+	// Pair makes the constructor NewFooE, returning the error of Validate,
+	// and NewFoo panic with it.
+	Pair bool
+	// ReturnsError makes the constructor return the error of the first of
+	// Validators failing on the built struct, such as Validate, and
+	// MustNewFoo panic with it unless Pair makes NewFoo do so.
+	ReturnsError bool
+	Validators   []string
+	// NilChecks are the parameters the constructor checks for nil (-nilcheck),
+	// returning an error if NilCheckError is set and panicking otherwise.
+	NilChecks     []string
+	NilCheckError bool
+	// ParamArgs are the names of the parameters in order, as passed on to
+	// NewFooE.
+	ParamArgs []string
+
+	// Options are the functional options the constructor takes after its
+	// parameters, if any.
+	Options *optionSet
+	// Guards are the unexported functions referred to by var _ = name so
+	// that they are not reported as unused (WithUsageGuards).
+	Guards []string
+}
+
+// paramDecls returns the parameter declarations of the constructor. With
+// group, consecutive parameters of the same type are declared together.
+func (p tmplParam) paramDecls(group bool) []string {
+	decls := make([]string, 0, len(p.Params))
+	var names []string
+	var typ string
+	flush := func() {
+		if len(names) > 0 {
+			decls = append(decls, strings.Join(names, ", ")+" "+typ)
+		}
+		names = nil
+	}
+	for _, f := range p.Params {
+		name, t := p.param(f)
+		if !group || t != typ {
+			flush()
+		}
+		names = append(names, name)
+		typ = t
+	}
+	flush()
+	return decls
+}
+
+// paramArgs returns the names of the parameters of the constructor.
+func (p tmplParam) paramArgs() []string {
+	args := make([]string, 0, len(p.Params))
+	for _, f := range p.Params {
+		name, _ := p.param(f)
+		args = append(args, name)
+	}
+	return args
+}
+
+// param returns the name and type of the parameter of the field f. With -e,
+// the field of the embedded interface is taken as x.
+func (p tmplParam) param(f FieldInfo) (string, string) {
+	if p.Extends && upperCamel(f.Name, nil) == p.InterfaceName {
+		return "x", p.InterfaceName
+	}
+	return f.ParamName, f.Type
 }
 
 type FieldInfo struct {
-	Type       string
-	Name       string
+	Type string
+	Name string
+	Kind FieldKind
+	// ConstValue is the expression a KindConstant field is set to.
 	ConstValue string
+	ParamName  string
+	// Derived is the expression a KindDerived field is computed from after
+	// the struct is built.
+	Derived string
+	// Fields are the fields a KindFlattened field is built from.
+	Fields []FieldInfo
+	// NopDefault is the value a nil parameter is replaced with.
+	NopDefault string
+	// Order is the position of the parameter pinned with the order tag,
+	// starting at 1, or 0 if it is not pinned.
+	Order int
+	// GenGetter makes a getter of the field generated.
+	GenGetter bool
+	// Transform is the function a parameter is passed through before it
+	// is assigned, if any.
+	Transform string
+	// Copy is "slice" or "map" when a parameter of that kind of type is
+	// copied before it is assigned, so that the caller cannot modify it
+	// afterwards, "pointer" when the value a pointer parameter points to is
+	// cloned, with its Clone method if any, and "func" when the parameter
+	// is cloned by the function Clone.
+	Copy  string
+	Clone string
+	// NonZero is the zero value of a parameter which must not be zero,
+	// such as 0 or "".
+	NonZero string
+	// Nilable reports whether the values of the type can be nil, as far as
+	// it is known without type information.
+	Nilable bool
+	// Inject reports whether the parameter is a dependency held by the
+	// factory of the struct (-factory).
+	Inject bool
+	// Optional reports whether a KindConstant field is set by its default
+	// tag, so that an option can override it (-options).
+	Optional bool
+
+	// Group is the name of the group of parameters set together or not at
+	// all, if any, and groupZero the value the field is unset with.
+	Group     string
+	groupZero string
+
+	pos token.Pos
+}
+
+// Flattened reports whether the field is an embedded struct built from
+// Fields in the constructor instead of taken as a parameter.
+func (f FieldInfo) Flattened() bool {
+	return f.Kind == KindFlattened
+}
+
+// Arg returns the expression a parameter field is assigned.
+func (f FieldInfo) Arg() string {
+	arg := f.ParamName
+	if f.Transform != "" {
+		arg = f.Transform + "(" + arg + ")"
+	}
+	switch f.Copy {
+	case "slice":
+		// nil stays nil
+		return "append(" + f.Type + "(nil), " + arg + "...)"
+	case "map":
+		return "func(m " + f.Type + ") " + f.Type + " {\n" +
+			"if m == nil {\nreturn nil\n}\n" +
+			"c := make(" + f.Type + ", len(m))\n" +
+			"for k, v := range m {\nc[k] = v\n}\n" +
+			"return c\n}(" + arg + ")"
+	case "pointer":
+		clone := "c := *p\nreturn &c"
+		if f.Clone != "" {
+			clone = "return p." + f.Clone + "()"
+		}
+		return "func(p " + f.Type + ") " + f.Type + " {\n" +
+			"if p == nil {\nreturn nil\n}\n" +
+			clone + "\n}(" + arg + ")"
+	case "func":
+		return f.Clone + "(" + arg + ")"
+	}
+	return arg
+}
+
+// resultLocals are the names the constructor template declares next to the
+// result: the options loop variable and parameter, the error of the Must
+// wrapper and validators, and the zero result.
+var resultLocals = map[string]bool{
+	"opt":        true,
+	optionsParam: true,
+	"err":        true,
+	"zero":       true,
+}
+
+// toResultName returns the name of the variable (or named result) the
+// constructor of structName builds into, avoiding keywords, the locals of
+// the template and parameter names.
+func toResultName(structName string, fields []FieldInfo) string {
+	name := lowerCamel(structName)
+	if token.Lookup(name).IsKeyword() || resultLocals[name] {
+		return "new" + upperCamel(structName, nil)
+	}
+	for _, f := range paramFields(fields) {
+		if f.ParamName == name {
+			return "new" + upperCamel(structName, nil)
+		}
+	}
+	return name
 }
 
 func match(a, b []string) []string {
@@ -1,13 +1,24 @@
 package genconstructor_test
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"go/ast"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"testing"
+	"time"
 
-	"github.com/hori-ryota/go-genconstructor/genconstructor"
+	"github.com/GuiltyMorishita/go-genconstructor/genconstructor"
 )
 
 func ExampleRun() {
@@ -53,3 +64,3081 @@ func ExampleRun() {
 	// 	}
 	// }
 }
+
+// generate writes src as a single-file package into a temporary directory
+// and returns what Run writes for it.
+func generate(t *testing.T, src string, opts ...genconstructor.Option) (string, error) {
+	t.Helper()
+	return generateFiles(t, map[string]string{"a.go": src}, opts...)
+}
+
+// generateFiles is generate for a package of several files, by name.
+func generateFiles(t *testing.T, files map[string]string, opts ...genconstructor.Option) (string, error) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	err = genconstructor.Run(
+		dir,
+		func(pkg *ast.Package) io.Writer {
+			return out
+		},
+		opts...,
+	)
+	return out.String(), err
+}
+
+func TestRun_namedReturn(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "value",
+			src: `package a
+
+//genconstructor -named-return
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFoo(
+	id string,
+) (foo Foo) {
+	foo = Foo{
+		id: id,
+	}
+	return foo
+}
+`,
+		},
+		{
+			name: "pointer",
+			src: `package a
+
+//genconstructor -p -named-return
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFoo(
+	id string,
+) (foo *Foo) {
+	foo = &Foo{
+		id: id,
+	}
+	return foo
+}
+`,
+		},
+		{
+			name: "collides with parameter",
+			src: `package a
+
+//genconstructor -named-return
+type User struct {
+	user string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewUser(
+	user string,
+) (newUser User) {
+	newUser = User{
+		user: user,
+	}
+	return newUser
+}
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got:\n%s\nwant suffix:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_validateMethod(t *testing.T) {
+	src := `package a
+
+import "io"
+
+type Store interface {
+	Get(key string) string
+}
+
+type Handler func()
+
+//genconstructor -validate-method
+type Foo struct {
+	name    string            ` + "`required:\"\"`" + `
+	store   Store             ` + "`required:\"\"`" + `
+	handler Handler           ` + "`required:\"\"`" + `
+	cache   map[string]string ` + "`required:\"\"`" + `
+	next    *Foo              ` + "`required:\"\"`" + `
+	tags    []string          ` + "`required:\"\"`" + `
+	w       io.Writer         ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func (x Foo) Validate() error {
+	if x.store == nil {
+		return errors.New("Foo.store must not be nil")
+	}
+	if x.handler == nil {
+		return errors.New("Foo.handler must not be nil")
+	}
+	if x.cache == nil {
+		return errors.New("Foo.cache must not be nil")
+	}
+	if x.next == nil {
+		return errors.New("Foo.next must not be nil")
+	}
+	return nil
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+	if !strings.Contains(got, `"errors"`) {
+		t.Errorf("errors is not imported:\n%s", got)
+	}
+}
+
+func TestRun_groups(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "set together",
+			src: `package a
+
+type Creds struct {
+	user     string ` + "`required:\"\" group:\"creds\"`" + `
+	password string ` + "`required:\"\" group:\"creds\"`" + `
+}
+
+//genconstructor -validate-method -flatten
+type Foo struct {
+	Creds
+	token  *string ` + "`required:\"\" group:\"creds\"`" + `
+	port   int     ` + "`required:\"\" group:\"addr\"`" + `
+	host   string  ` + "`required:\"\" group:\"addr\"`" + `
+	logger func()  ` + "`required:\"\"`" + `
+}
+`,
+			want: `func (x Foo) Validate() error {
+	if x.logger == nil {
+		return errors.New("Foo.logger must not be nil")
+	}
+	if !(x.Creds.user == "" && x.Creds.password == "" && x.token == nil) &&
+		!(x.Creds.user != "" && x.Creds.password != "" && x.token != nil) {
+		return errors.New("Foo: Creds.user, Creds.password, token of group creds must be set together or not at all")
+	}
+	if !(x.port == 0 && x.host == "") &&
+		!(x.port != 0 && x.host != "") {
+		return errors.New("Foo: port, host of group addr must be set together or not at all")
+	}
+	return nil
+}
+`,
+		},
+		{
+			name: "single field",
+			src: `package a
+
+//genconstructor -validate-method
+type Foo struct {
+	user string ` + "`required:\"\" group:\"creds\"`" + `
+}
+`,
+			wantErr: "Foo: group creds has a single field",
+		},
+		{
+			name: "without validate method",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	user     string ` + "`required:\"\" group:\"creds\"`" + `
+	password string ` + "`required:\"\" group:\"creds\"`" + `
+}
+`,
+			wantErr: "Foo: groups are checked by Validate and need -validate-method",
+		},
+		{
+			name: "unknown zero value",
+			src: `package a
+
+import "time"
+
+//genconstructor -validate-method
+type Foo struct {
+	since time.Time ` + "`required:\"\" group:\"range\"`" + `
+	until time.Time ` + "`required:\"\" group:\"range\"`" + `
+}
+`,
+			wantErr: "field since: group needs a nilable, number or string type",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got:\n%s\nwant suffix:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_pair(t *testing.T) {
+	src := `package a
+
+//genconstructor -p -pair
+type Foo struct {
+	key  string ` + "`required:\"\"`" + `
+	next *Foo   ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithDI(genconstructor.DIWire))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func NewFooE(
+	key string,
+	next *Foo,
+) (*Foo, error) {
+	foo := &Foo{
+		key:  key,
+		next: next,
+	}
+	if err := foo.Validate(); err != nil {
+		var zero *Foo
+		return zero, err
+	}
+	return foo, nil
+}
+
+func NewFoo(
+	key string,
+	next *Foo,
+) *Foo {
+	foo, err := NewFooE(key, next)
+	if err != nil {
+		panic(err)
+	}
+	return foo
+}
+
+func (x Foo) Validate() error {
+	if x.next == nil {
+		return errors.New("Foo.next must not be nil")
+	}
+	return nil
+}
+
+var ProviderSet = wire.NewSet(
+	NewFooE,
+)
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	_, err = generate(t, "package a\n\n//genconstructor -pair -named-return\ntype Foo struct{}\n")
+	if err == nil || !strings.Contains(err.Error(), "Foo: -pair cannot be used with -named-return") {
+		t.Errorf("error = %v, want -named-return to be rejected", err)
+	}
+}
+
+func TestRun_error(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Validate",
+			src: `package a
+
+//genconstructor -error
+type Foo struct {
+	key string ` + "`required:\"\" nonzero:\"true\"`" + `
+}
+`,
+			want: `func NewFoo(
+	key string,
+) (Foo, error) {
+	foo := Foo{
+		key: key,
+	}
+	if err := foo.Validate(); err != nil {
+		var zero Foo
+		return zero, err
+	}
+	return foo, nil
+}
+`,
+		},
+		{
+			name: "method",
+			src: `package a
+
+//genconstructor -p -error=validate
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+
+func (x *Foo) validate() error { return nil }
+`,
+			want: `func NewFoo(
+	key string,
+) (*Foo, error) {
+	foo := &Foo{
+		key: key,
+	}
+	if err := foo.validate(); err != nil {
+		var zero *Foo
+		return zero, err
+	}
+	return foo, nil
+}
+
+func MustNewFoo(
+	key string,
+) *Foo {
+	foo, err := NewFoo(key)
+	if err != nil {
+		panic(err)
+	}
+	return foo
+}
+`,
+		},
+		{
+			name: "struct Err",
+			src: `package a
+
+//genconstructor -p -error=validate
+type Err struct {
+	id string ` + "`required:\"\"`" + `
+}
+
+func (x *Err) validate() error { return nil }
+`,
+			want: `	newErr := &Err{
+		id: id,
+	}
+	if err := newErr.validate(); err != nil {
+		var zero *Err
+		return zero, err
+	}
+	return newErr, nil
+}
+
+func MustNewErr(
+	id string,
+) *Err {
+	newErr, err := NewErr(id)
+	if err != nil {
+		panic(err)
+	}
+	return newErr
+}
+`,
+		},
+		{
+			name: "method after Validate",
+			src: `package a
+
+//genconstructor -validate-method -error=check
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+
+func (x Foo) check() error { return nil }
+`,
+			want: `	if err := foo.Validate(); err != nil {
+		var zero Foo
+		return zero, err
+	}
+	if err := foo.check(); err != nil {
+		var zero Foo
+		return zero, err
+	}
+	return foo, nil
+}
+`,
+		},
+		{
+			name: "from",
+			src: `package a
+
+type Bar struct {
+	key string
+}
+
+//genconstructor -error -from=Bar
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFooFromBar(bar Bar) (Foo, error) {
+	return NewFoo(bar.key)
+}
+`,
+		},
+		{
+			name: "named return",
+			src: `package a
+
+//genconstructor -p -error -named-return
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+
+func (x *Foo) Validate() error { return nil }
+`,
+			want: `func NewFoo(
+	key string,
+) (foo *Foo, err error) {
+	foo = &Foo{
+		key: key,
+	}
+	if err := foo.Validate(); err != nil {
+		var zero *Foo
+		return zero, err
+	}
+	return foo, nil
+}
+
+func MustNewFoo(
+	key string,
+) *Foo {
+	foo, err := NewFoo(key)
+	if err != nil {
+		panic(err)
+	}
+	return foo
+}
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		src  string
+		want string
+	}{
+		{
+			src:  "package a\n\n//genconstructor -error=check\ntype Foo struct{}\n",
+			want: "Foo: method check of Foo is not declared",
+		},
+		{
+			src:  "package a\n\n//genconstructor -error -named-return\ntype Foo struct {\n\terr error `required:\"\"`\n}\n",
+			want: "Foo: parameter err of field err collides with the error of -named-return",
+		},
+	} {
+		if _, err := generate(t, tt.src); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestRun_name(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "name",
+			src: `package a
+
+//genconstructor -name BuildOrder
+type Order struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func BuildOrder(
+	id string,
+) Order {
+`,
+		},
+		{
+			name: "with -error",
+			src: `package a
+
+//genconstructor -name=BuildOrder -error
+type Order struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func MustBuildOrder(
+	id string,
+) Order {
+	order, err := BuildOrder(id)
+`,
+		},
+		{
+			name: "with -from",
+			src: `package a
+
+type Draft struct {
+	id string
+}
+
+//genconstructor -name BuildOrder -from=Draft
+type Order struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func BuildOrderFromDraft(draft Draft) Order {
+	return BuildOrder(draft.id)
+}
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src, genconstructor.WithDI(genconstructor.DIWire))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if !strings.Contains(got, "wire.NewSet(\n\tBuildOrder,\n)") {
+				t.Errorf("got:\n%s\nwant BuildOrder provided", got)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		src  string
+		want string
+	}{
+		{
+			src:  "package a\n\n//genconstructor -name=build-order\ntype Order struct{}\n",
+			want: `Order: invalid constructor name "build-order"`,
+		},
+		{
+			src:  "package a\n\n//genconstructor -name Build\ntype Order struct{}\n\n//genconstructor -name Build\ntype Item struct{}\n",
+			want: "Item: constructor Build is also generated for Order",
+		},
+	} {
+		if _, err := generate(t, tt.src); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestRun_unexported(t *testing.T) {
+	src := `package a
+
+//genconstructor -unexported -error
+type Order struct {
+	id string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`func newOrder(
+	id string,
+) (Order, error) {
+`,
+		`func mustNewOrder(
+	id string,
+) Order {
+	order, err := newOrder(id)
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		src  string
+		opts []genconstructor.Option
+		want string
+	}{
+		{
+			src:  "package a\n\n//genconstructor -unexported -name BuildOrder\ntype Order struct{}\n",
+			want: "Order: -unexported cannot be used with -name",
+		},
+		{
+			src:  "package a\n\n//genconstructor -unexported\ntype Order struct{}\n",
+			opts: []genconstructor.Option{genconstructor.WithSubpackage("ctor")},
+			want: "Order: unexported constructors cannot be used with a subpackage",
+		},
+	} {
+		if _, err := generate(t, tt.src, tt.opts...); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v, want %q", err, tt.want)
+		}
+	}
+}
+
+func TestRun_upperCasedStructName(t *testing.T) {
+	src := `package a
+
+//genconstructor -unexported -error
+type OrderDTO struct {
+	id string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`func newOrderDTO(
+	id string,
+) (OrderDTO, error) {
+	orderDTO := OrderDTO{`,
+		`func mustNewOrderDTO(
+	id string,
+) OrderDTO {
+	orderDTO, err := newOrderDTO(id)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestRun_usageGuards(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "constructor",
+			src: `package a
+
+//genconstructor -unexported
+type order struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func newOrder(
+	id string,
+) order {
+	return order{
+		id: id,
+	}
+}
+
+var _ = newOrder
+`,
+		},
+		{
+			name: "with Must",
+			src: `package a
+
+//genconstructor -unexported -error
+type Order struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `
+var (
+	_ = newOrder
+	_ = mustNewOrder
+)
+`,
+		},
+		{
+			name: "named",
+			src: `package a
+
+//genconstructor -name buildOrder
+type Order struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+			want: `
+var _ = buildOrder
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src, genconstructor.WithUsageGuards())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got:\n%s\nwant suffix:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name string
+		src  string
+	}{
+		{name: "exported", src: "package a\n\n//genconstructor\ntype Order struct{}\n"},
+		{name: "generic", src: "package a\n\n//genconstructor -unexported\ntype box[T any] struct{}\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src, genconstructor.WithUsageGuards())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(got, "_ =") {
+				t.Errorf("got guards:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestRun_staleOutput(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		opts []genconstructor.Option
+		want bool
+	}{
+		{name: "no marker", src: "package a\n\ntype Foo struct{}\n", want: true},
+		{name: "marker", src: "package a\n\n//genconstructor\ntype Foo struct{}\n"},
+		{
+			name: "marker in another file",
+			src:  "package a\n\n//genconstructor\ntype Foo struct{}\n",
+			opts: []genconstructor.Option{genconstructor.WithFiles("b.go")},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var removed []string
+			opts := append(tt.opts, genconstructor.WithStaleOutput(func(pkg *ast.Package) error {
+				removed = append(removed, pkg.Name)
+				return nil
+			}))
+			if _, err := generate(t, tt.src, opts...); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(removed) > 0; got != tt.want {
+				t.Errorf("removed = %v, want %v", removed, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_generatedFiles(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package a
+
+//genconstructor -options
+type Client struct {
+	timeout int
+}
+`,
+		// left from an earlier run
+		"a_constructor_gen.go": `package a
+
+type ClientOption func(*Client)
+
+func NewClient(opts ...ClientOption) Client { return Client{} }
+`,
+	}
+	got, err := generateFiles(t, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "type ClientOption func(*Client)"; !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	want := "option ClientOption is already declared at"
+	if _, err := generateFiles(t, files, genconstructor.WithGeneratedSuffix("")); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+
+	// named by -output
+	files["constructors.go"] = files["a_constructor_gen.go"]
+	delete(files, "a_constructor_gen.go")
+	if _, err := generateFiles(t, files, genconstructor.WithGeneratedFileName("constructors.go")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRun_withoutHeader(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithoutHeader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "Code generated") {
+		t.Errorf("header is not omitted:\n%s", got)
+	}
+	if !strings.HasPrefix(got, "package a\n") {
+		t.Errorf("got:\n%s\nwant it to start with the package clause", got)
+	}
+}
+
+func TestRun_hook(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithHook("onConstruct", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `var onConstruct func(name string)
+
+func NewFoo(
+	id string,
+) Foo {
+	if onConstruct != nil {
+		onConstruct("Foo")
+	}
+	return Foo{
+		id: id,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	t.Run("declared by the package", func(t *testing.T) {
+		got, err := generate(t, src+`
+var trace func(typ string)
+`, genconstructor.WithHook("trace", "func(typ string)"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(got, "var trace") {
+			t.Errorf("hook declared again:\n%s", got)
+		}
+		if !strings.Contains(got, `trace("Foo")`) {
+			t.Errorf("hook not called:\n%s", got)
+		}
+	})
+}
+
+func TestRun_singleLineParams(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	id   string ` + "`required:\"\"`" + `
+	name string ` + "`required:\"\"`" + `
+}
+
+//genconstructor
+type Bar struct {
+	id   string ` + "`required:\"\"`" + `
+	name string ` + "`required:\"\"`" + `
+	age  int    ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithSingleLineParams(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"func NewFoo(id string, name string) Foo {\n",
+		"func NewBar(\n\tid string,\n\tname string,\n\tage int,\n) Bar {\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestRun_di(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+
+//genconstructor -p
+type Bar struct {
+	foo Foo ` + "`required:\"\"`" + `
+}
+
+//genconstructor
+type Box[T any] struct {
+	v T ` + "`required:\"\"`" + `
+}
+`
+	for _, tt := range []struct {
+		di         string
+		wantImport string
+		want       string
+	}{
+		{
+			di:         genconstructor.DIFx,
+			wantImport: `"go.uber.org/fx"`,
+			want: `var Module = fx.Options(
+	fx.Provide(NewFoo),
+	fx.Provide(NewBar),
+)
+`,
+		},
+		{
+			di:         genconstructor.DIWire,
+			wantImport: `"github.com/google/wire"`,
+			want: `var ProviderSet = wire.NewSet(
+	NewFoo,
+	NewBar,
+)
+`,
+		},
+		{
+			di:         genconstructor.DIDo,
+			wantImport: `"github.com/samber/do"`,
+			want: `func Register(injector *do.Injector) {
+	do.Provide(injector, ProvideFoo)
+	do.Provide(injector, ProvideBar)
+}
+`,
+		},
+	} {
+		t.Run(tt.di, func(t *testing.T) {
+			got, err := generate(t, src, genconstructor.WithDI(tt.di))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.wantImport) {
+				t.Errorf("got:\n%s\nwant import %s", got, tt.wantImport)
+			}
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got:\n%s\nwant suffix:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("already declared", func(t *testing.T) {
+		_, err := generate(t, src+`
+var Module = 1
+`, genconstructor.WithDI(genconstructor.DIFx))
+		if err == nil || !strings.Contains(err.Error(), "Module is already declared") {
+			t.Errorf("error = %v, want the declared Module to be reported", err)
+		}
+	})
+
+	t.Run("interface", func(t *testing.T) {
+		got, err := generate(t, `package a
+
+import "io"
+
+//genconstructor -p -as io.Reader
+type Foo struct {
+	id string `+"`required:\"\"`"+`
+}
+
+func (f *Foo) Read(p []byte) (int, error) { return 0, io.EOF }
+
+type Bar interface {
+	Name() string
+}
+
+//genconstructor -s
+type bar struct {
+	name string `+"`required:\"\" getter:\"true\"`"+`
+}
+`, genconstructor.WithDI(genconstructor.DIFx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `var Module = fx.Options(
+	fx.Provide(fx.Annotate(NewFoo, fx.As(new(io.Reader)))),
+	fx.Provide(fx.Annotate(NewBar, fx.As(new(Bar)))),
+)
+`
+		if !strings.HasSuffix(got, want) {
+			t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+		}
+	})
+
+	t.Run("do", func(t *testing.T) {
+		got, err := generate(t, `package a
+
+//genconstructor -pair
+type Foo struct {
+	injector string `+"`required:\"\"`"+`
+	n        int    `+"`required:\"\"`"+`
+}
+
+//genconstructor -p
+type Bar struct {
+	foo Foo `+"`required:\"\"`"+`
+}
+`, genconstructor.WithDI(genconstructor.DIDo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{`func ProvideFoo(i *do.Injector) (Foo, error) {
+	injector, err := do.Invoke[string](i)
+	if err != nil {
+		return Foo{}, err
+	}
+	n, err := do.Invoke[int](i)
+	if err != nil {
+		return Foo{}, err
+	}
+	return NewFooE(injector, n)
+}
+`, `func ProvideBar(injector *do.Injector) (*Bar, error) {
+	foo, err := do.Invoke[Foo](injector)
+	if err != nil {
+		return nil, err
+	}
+	return NewBar(foo), nil
+}
+`} {
+			if !strings.Contains(got, want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		}
+
+		want := "Foo: parameter err collides with the error of ProvideFoo"
+		if _, err := generate(t, "package a\n\n//genconstructor\ntype Foo struct {\n\terr error `required:\"\"`\n}\n", genconstructor.WithDI(genconstructor.DIDo)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v, want %q", err, want)
+		}
+	})
+
+	t.Run("factory", func(t *testing.T) {
+		src := `package a
+
+//genconstructor -factory
+type Foo struct {
+	id  string       ` + "`required:\"\"`" + `
+	now func() int64 ` + "`required:\"\"`" + `
+}
+`
+		got, err := generate(t, src, genconstructor.WithDI(genconstructor.DIWire))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `var ProviderSet = wire.NewSet(
+	NewFoo,
+	NewFooFactory,
+)
+`
+		if !strings.HasSuffix(got, want) {
+			t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+		}
+
+		if got, err = generate(t, src, genconstructor.WithDI(genconstructor.DIDo)); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{`func ProvideFooFactory(injector *do.Injector) (*FooFactory, error) {
+	now, err := do.Invoke[func() int64](injector)
+	if err != nil {
+		return nil, err
+	}
+	return NewFooFactory(now), nil
+}
+`, `func Register(injector *do.Injector) {
+	do.Provide(injector, ProvideFoo)
+	do.Provide(injector, ProvideFooFactory)
+}
+`} {
+			if !strings.Contains(got, want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		}
+	})
+}
+
+func TestRun_crlf(t *testing.T) {
+	src := strings.ReplaceAll(`package a
+
+//genconstructor -p
+type Foo struct {
+	id string `+"`required:\"\"`"+`
+}
+`, "\n", "\r\n")
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, ") *Foo {") {
+		t.Errorf("got:\n%s\nwant a pointer result", got)
+	}
+}
+
+func TestRun_getters(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "struct default with overrides",
+			src: `package a
+
+//genconstructor -g
+type Foo struct {
+	key    string ` + "`required:\"\"`" + `
+	secret string ` + "`required:\"\" getter:\"false\"`" + `
+	Name   string ` + "`required:\"\"`" + `
+	note   string
+}
+`,
+			want: `func (x Foo) Key() string {
+	return x.key
+}
+`,
+		},
+		{
+			name: "field opt-in",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	id   string ` + "`required:\"\"`" + `
+	size int    ` + "`required:\"10\" getter:\"true\"`" + `
+}
+`,
+			want: `	return Foo{
+		id:   id,
+		size: 10,
+	}
+}
+
+func (x Foo) Size() int {
+	return x.size
+}
+`,
+		},
+		{
+			name: "empty tag",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	id    string ` + "`required:\"\"`" + `
+	price int    ` + "`required:\"\" getter:\"\"`" + `
+}
+`,
+			want: `func (x Foo) Price() int {
+	return x.price
+}
+`,
+		},
+		{
+			name: "-getters",
+			src: `package a
+
+//genconstructor -getters
+type Foo struct {
+	key  string ` + "`required:\"\"`" + `
+	Name string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func (x Foo) Key() string {
+	return x.key
+}
+`,
+		},
+		{
+			name: "exported field",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	Name string ` + "`required:\"\" getter:\"true\"`" + `
+}
+`,
+			wantErr: "field Name: exported fields cannot have a getter of the same name",
+		},
+		{
+			name: "field left alone",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	key  string ` + "`required:\"\" getter:\"true\"`" + `
+	note string ` + "`getter:\"\"`" + `
+}
+`,
+			want: `func (x Foo) Key() string {
+	return x.key
+}
+`,
+		},
+		{
+			name: "go-genaccessor",
+			src: `package a
+
+//genaccessor
+//genconstructor -g
+type Foo struct {
+	key  string ` + "`required:\"\"`" + `
+	name string ` + "`required:\"\" getter:\"\"`" + `
+	size int    ` + "`required:\"\" getter:\"Length\"`" + `
+}
+`,
+			want: `func (x Foo) Key() string {
+	return x.key
+}
+`,
+		},
+		{
+			name: "unknown value",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\" getter:\"yes\"`" + `
+}
+`,
+			wantErr: "field id: getter tag needs \"true\", \"false\" or nothing",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got:\n%s\nwant suffix:\n%s", got, tt.want)
+			}
+			if strings.Count(got, "func (x Foo)") != 1 {
+				t.Errorf("got:\n%s\nwant a single getter", got)
+			}
+		})
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := new(bytes.Buffer)
+	src.WriteString("package a\n\nimport \"time\"\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(src, `
+//genconstructor -p
+type Foo%d struct {
+	id        string    `+"`required:\"\"`"+`
+	name      string    `+"`required:\"\"`"+`
+	createdAt time.Time `+"`required:\"time.Now()\"`"+`
+}
+`, i)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), src.Bytes(), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := genconstructor.Run(
+			dir,
+			func(pkg *ast.Package) io.Writer {
+				return ioutil.Discard
+			},
+		); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRun_groupedParams(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	key  string ` + "`required:\"\"`" + `
+	name string ` + "`required:\"\"`" + `
+	age  int    ` + "`required:\"\"`" + `
+	note string ` + "`required:\"\"`" + `
+}
+`
+	for _, tt := range []struct {
+		name string
+		opts []genconstructor.Option
+		want string
+	}{
+		{
+			name: "multiline",
+			opts: []genconstructor.Option{genconstructor.WithGroupedParams()},
+			want: "func NewFoo(\n\tkey, name string,\n\tage int,\n\tnote string,\n) Foo {\n\treturn Foo{\n\t\tkey:  key,\n\t\tname: name,\n",
+		},
+		{
+			name: "single line",
+			opts: []genconstructor.Option{genconstructor.WithGroupedParams(), genconstructor.WithSingleLineParams(4)},
+			want: "func NewFoo(key, name string, age int, note string) Foo {\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, src, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_returnType(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "local interface",
+			src: `package a
+
+type FooReader interface {
+	Read() string
+}
+
+//genconstructor -p -return=FooReader
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+
+func (f *Foo) Read() string { return f.key }
+`,
+			want: `func NewFoo(
+	key string,
+) FooReader {
+	return &Foo{
+		key: key,
+	}
+}
+`,
+		},
+		{
+			name: "qualified interface",
+			src: `package a
+
+import "io"
+
+//genconstructor -p -return=io.Reader
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			want: `import (
+	"io"
+)
+
+func NewFoo(
+	key string,
+) io.Reader {
+`,
+		},
+		{
+			name: "not imported",
+			src: `package a
+
+//genconstructor -return=io.Reader
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			wantErr: "Foo: package io of io.Reader is not imported",
+		},
+		{
+			name: "as",
+			src: `package a
+
+import "io"
+
+//genconstructor -p -as io.Reader
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFoo(
+	key string,
+) io.Reader {
+`,
+		},
+		{
+			name: "import path",
+			src: `package a
+
+//genconstructor -p -as encoding/json.Marshaler
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			want: `import (
+	"encoding/json"
+)
+
+func NewFoo(
+	key string,
+) json.Marshaler {
+`,
+		},
+		{
+			name: "import path imported under another name",
+			src: `package a
+
+import js "encoding/json"
+
+var _ js.Marshaler
+
+//genconstructor -p -as=encoding/json.Marshaler
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			want: `) js.Marshaler {
+`,
+		},
+		{
+			name: "import path without the type",
+			src: `package a
+
+//genconstructor -as encoding/json.Repository
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			wantErr: "Foo: type Repository is not declared by package encoding/json",
+		},
+		{
+			name: "named return",
+			src: `package a
+
+//genconstructor -named-return -return=FooReader
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			wantErr: "Foo: -return cannot be used with -named-return",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_from(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "same-named fields",
+			src: `package a
+
+type FooDTO struct {
+	Key   string
+	Name  string
+	Count int64
+}
+
+//genconstructor -p -from=FooDTO
+type Foo struct {
+	key   string ` + "`required:\"\"`" + `
+	name  string ` + "`required:\"\"`" + `
+	count int    ` + "`required:\"\"`" + `
+	owner string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFooFromFooDTO(fooDTO FooDTO, count int, owner string) *Foo {
+	return NewFoo(fooDTO.Key, fooDTO.Name, count, owner)
+}
+`,
+		},
+		{
+			name: "parameter named after the source",
+			src: `package a
+
+type Src struct {
+	Key string
+}
+
+//genconstructor -from=Src
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+	src string ` + "`required:\"\"`" + `
+}
+`,
+			want: `func NewFooFromSrc(srcSrc Src, src string) Foo {
+	return NewFoo(srcSrc.Key, src)
+}
+`,
+		},
+		{
+			name: "not a local struct",
+			src: `package a
+
+//genconstructor -from=pb.Foo
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			wantErr: "Foo: -from=pb.Foo: not a struct declared in the package",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_subpackage(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "qualified",
+			src: `package a
+
+import "time"
+
+type Level int
+
+const DefaultLevel Level = 1
+
+type Base struct {
+	Owner string ` + "`required:\"\"`" + `
+}
+
+//genconstructor -p -flatten
+type Foo struct {
+	Base
+	Key     string            ` + "`required:\"\"`" + `
+	Levels  map[string]*Level ` + "`required:\"\"`" + `
+	Level   Level             ` + "`required:\"DefaultLevel\"`" + `
+	Timeout time.Duration     ` + "`required:\"\"`" + `
+}
+`,
+			want: []string{
+				"package ctor\n",
+				`	"time"
+
+	a "example.com/`,
+				`func NewFoo(
+	owner string,
+	key string,
+	levels map[string]*a.Level,
+	timeout time.Duration,
+) *a.Foo {
+	return &a.Foo{
+		Base: a.Base{
+			Owner: owner,
+		},
+		Key:     key,
+		Levels:  levels,
+		Level:   a.DefaultLevel,
+		Timeout: timeout,
+	}
+}
+`,
+			},
+		},
+		{
+			name: "unexported field",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+			wantErr: "Foo: field key is unexported and cannot be set from package ctor",
+		},
+		{
+			name: "unexported type",
+			src: `package a
+
+type level int
+
+//genconstructor
+type Foo struct {
+	Level level ` + "`required:\"\"`" + `
+}
+`,
+			wantErr: "Foo: field Level: level is not exported and cannot be used from another package",
+		},
+		{
+			name: "method",
+			src: `package a
+
+//genconstructor -validate-method
+type Foo struct {
+	Key string ` + "`required:\"\"`" + `
+}
+`,
+			wantErr: "Foo: -validate-method cannot be used with a subpackage",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src, genconstructor.WithSubpackage("ctor"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("got:\n%s\nwant:\n%s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_plugin(t *testing.T) {
+	src := `package a
+
+//genconstructor -p
+type Foo struct {
+	key  string ` + "`required:\"\"`" + `
+	hits int
+}
+`
+	reset := func(ctx genconstructor.GenContext) ([]byte, error) {
+		ctx.AddImport("", "sync")
+		b := new(bytes.Buffer)
+		fmt.Fprintf(b, "var %sPool sync.Pool\n\n", ctx.StructName)
+		fmt.Fprintf(b, "func (x *%s) Reset() {\n", ctx.StructName)
+		for _, f := range ctx.Params {
+			fmt.Fprintf(b, "var %s %s\nx.%s = %s\n", f.ParamName, f.Type, f.Name, f.ParamName)
+		}
+		b.WriteString("}\n")
+		return b.Bytes(), nil
+	}
+	got, err := generate(t, src, genconstructor.WithPlugin(reset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`import (
+	"sync"
+)
+`,
+		`	return &Foo{
+		key: key,
+	}
+}
+
+var FooPool sync.Pool
+
+func (x *Foo) Reset() {
+	var key string
+	x.key = key
+}
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+
+	failing := func(genconstructor.GenContext) ([]byte, error) {
+		return nil, errors.New("unsupported")
+	}
+	if _, err := generate(t, src, genconstructor.WithPlugin(failing)); err == nil || !strings.Contains(err.Error(), "Foo: plugin: unsupported") {
+		t.Errorf("error = %v, want the plugin error", err)
+	}
+}
+
+func TestRun_fieldAssertions(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	key  string ` + "`required:\"\"`" + `
+	a, b int
+	_    struct{}
+	Bar
+}
+
+type Bar struct{}
+
+//genconstructor
+type Box[T any] struct {
+	value T ` + "`required:\"\"`" + `
+}
+`
+	assertions := new(bytes.Buffer)
+	var reported []genconstructor.Diagnostic
+	if _, err := generate(t, src,
+		genconstructor.WithFieldAssertions(func(pkg *ast.Package) io.Writer {
+			return assertions
+		}),
+		genconstructor.WithDiagnosticsSink(func(d genconstructor.Diagnostic) {
+			reported = append(reported, d)
+		}),
+	); err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by go-genconstructor; DO NOT EDIT.
+
+package a
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenconstructorFieldCounts(t *testing.T) {
+	for _, tt := range []struct {
+		typ  reflect.Type
+		want int
+	}{
+		{reflect.TypeOf((*Foo)(nil)).Elem(), 5},
+	} {
+		if got := tt.typ.NumField(); got != tt.want {
+			t.Errorf("%s has %d fields, want %d; regenerate its constructor", tt.typ, got, tt.want)
+		}
+	}
+}
+`
+	if got := assertions.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if len(reported) != 1 || reported[0].Message != "the fields of generic Box are not asserted" {
+		t.Errorf("reported %v, want a warning about Box", reported)
+	}
+}
+
+func TestRun_generatorName(t *testing.T) {
+	// as -stamp names the generator
+	const name = "go-genconstructor (module github.com/GuiltyMorishita/go-genconstructor v1.2.0)"
+	assertions := new(bytes.Buffer)
+	got, err := generate(t, `package a
+
+//genconstructor
+type Foo struct {
+	key string `+"`required:\"\"`"+`
+}
+`,
+		genconstructor.WithGeneratorName(name),
+		genconstructor.WithFieldAssertions(func(pkg *ast.Package) io.Writer {
+			return assertions
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "// Code generated by " + name + "; DO NOT EDIT.\n\npackage a\n"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("got:\n%s\nwant prefix:\n%s", got, want)
+	}
+	if !strings.HasPrefix(assertions.String(), want) {
+		t.Errorf("got assertions:\n%s\nwant prefix:\n%s", assertions, want)
+	}
+}
+
+func TestRun_constructorTests(t *testing.T) {
+	src := `package a
+
+import (
+	"io"
+	"time"
+)
+
+//genconstructor -nilcheck
+type Foo struct {
+	out     io.Writer     ` + "`required:\"\"`" + `
+	timeout time.Duration ` + "`required:\"\"`" + `
+	at      time.Time     ` + "`required:\"time.Now()\"`" + `
+}
+
+//genconstructor -error
+type Bar struct {
+	n int ` + "`required:\"\"`" + `
+}
+
+//genconstructor
+type Box[T any] struct {
+	value T ` + "`required:\"\"`" + `
+}
+`
+	tests := new(bytes.Buffer)
+	newWriter := func(pkg *ast.Package) io.Writer {
+		return tests
+	}
+	var reported []genconstructor.Diagnostic
+	if _, err := generate(t, src,
+		genconstructor.WithFieldAssertions(newWriter),
+		genconstructor.WithConstructorTests(newWriter),
+		genconstructor.WithDiagnosticsSink(func(d genconstructor.Diagnostic) {
+			reported = append(reported, d)
+		}),
+	); err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+`
+	if !strings.Contains(tests.String(), want) {
+		t.Errorf("got:\n%s\nwant:\n%s", tests, want)
+	}
+	want = `func TestGenconstructorConstructors(t *testing.T) {
+	t.Run("NewFoo", func(t *testing.T) {
+		// the zero values may be rejected by the checks
+		defer func() { _ = recover() }()
+		_ = NewFoo(*new(io.Writer), *new(time.Duration))
+	})
+	t.Run("NewBar", func(t *testing.T) {
+		// the zero values may be rejected by the checks
+		defer func() { _ = recover() }()
+		_, _ = NewBar(*new(int))
+	})
+}
+`
+	if !strings.HasSuffix(tests.String(), want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", tests, want)
+	}
+	var messages []string
+	for _, d := range reported {
+		messages = append(messages, d.Message)
+	}
+	if len(messages) != 2 || messages[1] != "the constructor of generic Box is not tested" {
+		t.Errorf("reported %q, want warnings about Box", messages)
+	}
+
+	_, err := generate(t, src, genconstructor.WithConstructorTests(newWriter), genconstructor.WithSubpackage("ctor"))
+	if want := "the constructors of a subpackage cannot be tested by the package of the structs"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestRun_skipIfUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(src, []byte("package a\n\n//genconstructor\ntype Foo struct {\n\tkey string `required:\"\"`\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "a_constructor_gen.go")
+	if err := ioutil.WriteFile(output, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, tt := range []struct {
+		name      string
+		srcTime   time.Time
+		generated bool
+	}{
+		{name: "output is newer", srcTime: now.Add(-time.Hour), generated: false},
+		{name: "source is newer", srcTime: now.Add(time.Hour), generated: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Chtimes(src, tt.srcTime, tt.srcTime); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(output, now, now); err != nil {
+				t.Fatal(err)
+			}
+			out := new(bytes.Buffer)
+			err := genconstructor.Run(
+				dir,
+				func(pkg *ast.Package) io.Writer {
+					return out
+				},
+				genconstructor.WithSkipIfUpToDate(func(pkg *ast.Package) string {
+					return output
+				}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if generated := out.Len() > 0; generated != tt.generated {
+				t.Errorf("generated = %v, want %v", generated, tt.generated)
+			}
+		})
+	}
+}
+
+func TestRun_manifest(t *testing.T) {
+	src := `//go:build linux
+
+package a
+
+//genconstructor
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+
+//genconstructor
+type Box[T any] struct {
+	value T ` + "`required:\"\"`" + `
+}
+`
+	manifest := new(bytes.Buffer)
+	if _, err := generate(t, src, genconstructor.WithManifest("example.com/registry", func() io.Writer {
+		return manifest
+	})); err != nil {
+		t.Fatal(err)
+	}
+	got := manifest.String()
+	for _, want := range []string{
+		"//go:build linux\n",
+		"package registry\n",
+		`	a "example.com/`,
+		`var Constructors = map[string]any{
+	"example.com/`,
+		`.Foo": a.NewFoo,
+}
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+	if strings.Contains(got, "NewBox") {
+		t.Errorf("generic constructor is registered:\n%s", got)
+	}
+}
+
+func TestRun_files(t *testing.T) {
+	files := map[string]string{
+		"gen.go": `package a
+
+//go:generate go-genconstructor
+`,
+		"foo.go": `package a
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+		"bar.go": `package a
+
+//genconstructor
+type Bar struct {
+	id string ` + "`required:\"\"`" + `
+}
+`,
+	}
+	for _, tt := range []struct {
+		name     string
+		opts     []genconstructor.Option
+		want     []string
+		wantNone []string
+	}{
+		{
+			name: "whole package",
+			want: []string{"func NewFoo(", "func NewBar("},
+		},
+		{
+			name:     "scoped",
+			opts:     []genconstructor.Option{genconstructor.WithFiles("foo.go")},
+			want:     []string{"func NewFoo("},
+			wantNone: []string{"func NewBar("},
+		},
+		{
+			name:     "structs",
+			opts:     []genconstructor.Option{genconstructor.WithStructs(regexp.MustCompile("^Ba"))},
+			want:     []string{"func NewBar("},
+			wantNone: []string{"func NewFoo("},
+		},
+		{
+			name:     "files and structs",
+			opts:     []genconstructor.Option{genconstructor.WithFiles("foo.go"), genconstructor.WithStructs(regexp.MustCompile("^Foo$"))},
+			want:     []string{"func NewFoo("},
+			wantNone: []string{"func NewBar("},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateFiles(t, files, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("got:\n%s\nwant %s", got, want)
+				}
+			}
+			for _, none := range tt.wantNone {
+				if strings.Contains(got, none) {
+					t.Errorf("got:\n%s\nwant no %s", got, none)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_nonZero(t *testing.T) {
+	src := `package a
+
+type Count int
+
+//genconstructor -validate-method
+type Foo struct {
+	id    string  ` + "`required:\"\" nonzero:\"true\"`" + `
+	size  int     ` + "`required:\"\" nonzero:\"true\"`" + `
+	ratio float64 ` + "`required:\"\" nonzero:\"true\"`" + `
+	count Count   ` + "`required:\"\" nonzero:\"true\"`" + `
+	note  string  ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func (x Foo) Validate() error {
+	if x.id == "" {
+		return errors.New("Foo.id must not be empty")
+	}
+	if x.size == 0 {
+		return errors.New("Foo.size must not be zero")
+	}
+	if x.ratio == 0 {
+		return errors.New("Foo.ratio must not be zero")
+	}
+	if x.count == 0 {
+		return errors.New("Foo.count must not be zero")
+	}
+	return nil
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{
+			name: "not a number or string",
+			src: `package a
+
+//genconstructor -validate-method
+type Foo struct {
+	ids []int ` + "`required:\"\" nonzero:\"true\"`" + `
+}
+`,
+			wantErr: "field ids: nonzero needs a number or string type",
+		},
+		{
+			name: "without -validate-method",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	size int ` + "`required:\"\" nonzero:\"true\"`" + `
+}
+`,
+			wantErr: "Foo: nonzero fields are checked by Validate and need -validate-method",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generate(t, tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRun_tagKey(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	id       string ` + "`ctor:\"\"`" + `
+	retries  int    ` + "`ctor:\"3\"`" + `
+	required string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithTagKey("ctor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func NewFoo(
+	id string,
+) Foo {
+	return Foo{
+		id:      id,
+		retries: 3,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	if _, err := generate(t, src, genconstructor.WithTagKey("a b")); err == nil {
+		t.Error("want error for invalid tag key")
+	}
+}
+
+func TestRun_recursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := `package %s
+
+//genconstructor
+type Foo struct {
+	id string ` + "`required:\"\"`" + `
+}
+`
+	for path, pkg := range map[string]string{
+		"a.go":                 "a",
+		"b/b.go":               "b",
+		"b/c/c.go":             "c",
+		"vendor/v/v.go":        "v",
+		"testdata/t.go":        "t",
+		".hidden/h.go":         "h",
+		"_skipped/s.go":        "s",
+		"b/unmarked/d.go":      "",
+		"b/unmarked/README.md": "",
+	} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		content := "package d\n"
+		if pkg != "" {
+			content = fmt.Sprintf(src, pkg)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	err = genconstructor.Run(
+		filepath.ToSlash(dir)+"/...",
+		func(pkg *ast.Package) io.Writer {
+			got = append(got, pkg.Name)
+			return ioutil.Discard
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, tt := range []struct {
+		excluded []string
+		want     []string
+	}{
+		{excluded: []string{"c"}, want: []string{"a", "b"}},
+		{excluded: []string{"b/c"}, want: []string{"a", "b"}},
+		{excluded: []string{"./b/"}, want: []string{"a"}},
+		{excluded: []string{"*/c"}, want: []string{"a", "b"}},
+	} {
+		got = nil
+		err = genconstructor.Run(
+			filepath.ToSlash(dir)+"/...",
+			func(pkg *ast.Package) io.Writer {
+				got = append(got, pkg.Name)
+				return ioutil.Discard
+			},
+			genconstructor.WithExcludedDirs(tt.excluded...),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("excluded %q: got %v, want %v", tt.excluded, got, tt.want)
+		}
+	}
+}
+
+func TestRun_jobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i := 0; i < 20; i++ {
+		pkg := fmt.Sprintf("p%02d", i)
+		src := fmt.Sprintf("package %s\n\n//genconstructor -unknown\ntype Foo struct {\n\tid string `required:\"\"`\n}\n", pkg)
+		if i%5 == 0 {
+			src = fmt.Sprintf("package %s\n", pkg)
+		}
+		path := filepath.Join(dir, pkg, "a.go")
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run := func(opts ...genconstructor.Option) (map[string]string, []string) {
+		var mu sync.Mutex
+		outs := make(map[string]*bytes.Buffer)
+		var diags []string
+		opts = append(opts, genconstructor.WithDiagnosticsSink(func(d genconstructor.Diagnostic) {
+			diags = append(diags, d.Error())
+		}))
+		err := genconstructor.Run(
+			filepath.ToSlash(dir)+"/...",
+			func(pkg *ast.Package) io.Writer {
+				mu.Lock()
+				defer mu.Unlock()
+				b := new(bytes.Buffer)
+				outs[pkg.Name] = b
+				return b
+			},
+			opts...,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string, len(outs))
+		for name, b := range outs {
+			got[name] = b.String()
+		}
+		return got, diags
+	}
+	wantOuts, wantDiags := run()
+	if len(wantOuts) != 16 {
+		t.Fatalf("got %d packages generated for, want 16", len(wantOuts))
+	}
+	gotOuts, gotDiags := run(genconstructor.WithJobs(4))
+	if !reflect.DeepEqual(gotOuts, wantOuts) {
+		t.Errorf("got:\n%v\nwant:\n%v", gotOuts, wantOuts)
+	}
+	if !reflect.DeepEqual(gotDiags, wantDiags) {
+		t.Errorf("diagnostics:\n%q\nwant in order:\n%q", gotDiags, wantDiags)
+	}
+}
+
+func TestRun_cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(src, []byte("package a\n\n//genconstructor\ntype Foo struct {\n\tkey string `required:\"\"`\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cachePath := filepath.Join(dir, ".genconstructor.cache")
+
+	run := func(fingerprint string) bool {
+		t.Helper()
+		cache, err := genconstructor.OpenCache(cachePath, fingerprint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(bytes.Buffer)
+		err = genconstructor.Run(
+			dir,
+			func(pkg *ast.Package) io.Writer {
+				return out
+			},
+			genconstructor.WithCache(cache),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cache.Save(); err != nil {
+			t.Fatal(err)
+		}
+		return out.Len() > 0
+	}
+	if !run("v1") {
+		t.Fatal("not generated on the first run")
+	}
+	if run("v1") {
+		t.Error("generated for unchanged files")
+	}
+	if !run("v2") {
+		t.Error("not generated for another fingerprint")
+	}
+	if err := ioutil.WriteFile(src, []byte("package a\n\n//genconstructor\ntype Foo struct {\n\tname string `required:\"\"`\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !run("v2") {
+		t.Error("not generated for a changed file")
+	}
+
+	cache, err := genconstructor.OpenCache(cachePath, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a cache cannot be used with a manifest"
+	err = genconstructor.Run(dir, func(pkg *ast.Package) io.Writer { return ioutil.Discard },
+		genconstructor.WithCache(cache),
+		genconstructor.WithManifest("m", func() io.Writer { return ioutil.Discard }))
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
+
+func TestRun_defaultMarker(t *testing.T) {
+	src := `package a
+
+//genconstructor
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+
+//genconstructor -named-return
+type Bar struct {
+	key string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithDefaultMarker("-p -g"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`func NewFoo(
+	key string,
+) *Foo {
+`,
+		`func (x Foo) Key() string {`,
+		`func NewBar(
+	key string,
+) (bar *Bar) {
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestRun_groupedSpecs(t *testing.T) {
+	src := `package a
+
+type (
+	//genconstructor -p
+	Foo struct {
+		key string ` + "`required:\"\"`" + `
+	}
+
+	Bar struct {
+		key string ` + "`required:\"\"`" + `
+	}
+
+	Baz struct{ key string ` + "`required:\"\"`" + ` } //genconstructor
+)
+
+//genconstructor
+type (
+	Qux  struct{}
+	Quux struct{}
+)
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"func NewFoo(\n\tkey string,\n) *Foo {",
+		"func NewBaz(\n\tkey string,\n) Baz {",
+		"func NewQux() Qux {",
+		"func NewQuux() Quux {",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+	if strings.Contains(got, "func NewBar(") {
+		t.Errorf("got:\n%s\nwant no NewBar", got)
+	}
+}
+
+func TestRun_marker(t *testing.T) {
+	src := `package a
+
+//myco:constructor -p
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+
+//genconstructor
+type Bar struct {
+	key string ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src, genconstructor.WithMarker("//myco:constructor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "func NewFoo(\n\tkey string,\n) *Foo {"; !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if strings.Contains(got, "func NewBar(") {
+		t.Errorf("got:\n%s\nwant no NewBar", got)
+	}
+
+	for _, marker := range []string{"", "myco:constructor", "//", "// myco"} {
+		if _, err := generate(t, src, genconstructor.WithMarker(marker)); err == nil || !strings.Contains(err.Error(), "invalid marker") {
+			t.Errorf("WithMarker(%q): got %v, want invalid marker", marker, err)
+		}
+	}
+}
+
+func TestRun_initialisms(t *testing.T) {
+	src := `package a
+
+type draft struct {
+	SKU string
+}
+
+//genconstructor -g -options -from=draft
+type itemSku struct {
+	sku   string ` + "`required:\"\"`" + `
+	dtoID string
+}
+`
+	got, err := generate(t, src, genconstructor.WithInitialisms("sku", "DTO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`type ItemSKUOption func(*itemSku)`,
+		`func NewItemSKU(
+	sku string,
+	opts ...ItemSKUOption,
+) itemSku {
+`,
+		`func WithDTOID(dtoID string) ItemSKUOption {`,
+		`func NewItemSKUFromDraft(draft draft) itemSku {
+	return NewItemSKU(draft.SKU)
+}
+`,
+		`func (x itemSku) SKU() string {`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestRun_factory(t *testing.T) {
+	src := `package a
+
+import "time"
+
+type IDGenerator interface {
+	NewID() string
+}
+
+//genconstructor -factory -error
+type Order struct {
+	id    string           ` + "`required:\"\"`" + `
+	clock func() time.Time ` + "`required:\"\"`" + `
+	ids   IDGenerator      ` + "`required:\"\"`" + `
+	f     int              ` + "`required:\"\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `type OrderFactory struct {
+	clock func() time.Time
+	ids   IDGenerator
+}
+
+func NewOrderFactory(clock func() time.Time, ids IDGenerator) *OrderFactory {
+	return &OrderFactory{
+		clock: clock,
+		ids:   ids,
+	}
+}
+
+func (factory *OrderFactory) Create(id string, f int) (Order, error) {
+	return NewOrder(id, factory.clock, factory.ids, f)
+}
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "generic",
+			src: `package a
+
+//genconstructor -factory -options
+type Cache[K comparable, V any] struct {
+	load  func(K) V ` + "`required:\"\"`" + `
+	limit int
+}
+`,
+			want: `func (f *CacheFactory[K, V]) Create(opts ...CacheOption[K, V]) Cache[K, V] {
+	return NewCache[K, V](f.load, opts...)
+}`,
+		},
+		{
+			name: "unexported",
+			src: `package a
+
+//genconstructor -factory -unexported -p
+type Foo struct {
+	now func() int ` + "`required:\"\"`" + `
+}
+`,
+			want: `func newFooFactory(now func() int) *FooFactory {`,
+		},
+		{
+			name: "inject",
+			src: `package a
+
+import "io"
+
+//genconstructor -factory
+type Foo struct {
+	out    io.Writer    ` + "`required:\"\" inject:\"true\"`" + `
+	filter func() bool  ` + "`required:\"\" inject:\"false\"`" + `
+	now    func() int64 ` + "`required:\"\"`" + `
+}
+`,
+			want: `type FooFactory struct {
+	out io.Writer
+	now func() int64
+}
+
+func NewFooFactory(out io.Writer, now func() int64) *FooFactory {
+	return &FooFactory{
+		out: out,
+		now: now,
+	}
+}
+
+func (f *FooFactory) Create(filter func() bool) Foo {
+	return NewFoo(f.out, filter, f.now)
+}`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "no dependency",
+			src:  "package a\n\n//genconstructor -factory\ntype Foo struct {\n\tid string `required:\"\"`\n}\n",
+			want: "Foo: -factory needs a dependency: a parameter of a func or interface type or tagged inject:\"true\"",
+		},
+		{
+			name: "declared",
+			src:  "package a\n\ntype FooFactory struct{}\n\n//genconstructor -factory\ntype Foo struct {\n\tnow func() int `required:\"\"`\n}\n",
+			want: "Foo: factory FooFactory is already declared at",
+		},
+		{
+			name: "inject without -factory",
+			src:  "package a\n\n//genconstructor\ntype Foo struct {\n\tnow func() int `required:\"\" inject:\"true\"`\n}\n",
+			want: "field now: inject needs -factory",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := generate(t, tt.src); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_reconstruct(t *testing.T) {
+	src := `package a
+
+import "time"
+
+type Audit struct {
+	at time.Time
+}
+
+//genconstructor -p -reconstruct
+type Order struct {
+	Audit
+	id     string ` + "`required:\"\"`" + `
+	status string ` + "`required:\"\\\"new\\\"\"`" + `
+	_      int
+	kind, tag string ` + "`ctorignore:\"true\"`" + `
+	typ    int
+	Type   int
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `func ReconstructOrder(audit Audit, id string, status string, kind string, tag string, typ int, typeValue int) *Order {
+	return &Order{
+		Audit:  audit,
+		id:     id,
+		status: status,
+		kind:   kind,
+		tag:    tag,
+		typ:    typ,
+		Type:   typeValue,
+	}
+}
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "super",
+			src:  "package a\n\n//genconstructor -s -reconstruct\ntype Foo struct {\n\tid string `required:\"\"`\n}\n",
+			want: "Foo: -reconstruct cannot be used with -s or -e",
+		},
+		{
+			name: "same parameter",
+			src:  "package a\n\n//genconstructor -reconstruct\ntype Foo struct {\n\tID string `required:\"\"`\n\tid string\n}\n",
+			want: "Foo: fields ID and id are both reconstructed from parameter id",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := generate(t, tt.src); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_options(t *testing.T) {
+	src := `package a
+
+import "time"
+
+//genconstructor -options
+type Client struct {
+	addr    string ` + "`required:\"\"`" + `
+	timeout time.Duration
+	x       bool
+	skip    int ` + "`ctorignore:\"true\"`" + `
+}
+`
+	got, err := generate(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `import (
+	"time"
+)
+
+func NewClient(
+	addr string,
+	opts ...ClientOption,
+) Client {
+	client := Client{
+		addr: addr,
+	}
+	for _, opt := range opts {
+		opt(&client)
+	}
+	return client
+}
+
+type ClientOption func(*Client)
+
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(x *Client) {
+		x.timeout = timeout
+	}
+}
+
+func WithX(v bool) ClientOption {
+	return func(x *Client) {
+		x.x = v
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "generic",
+			src: `package a
+
+//genconstructor -options -pair
+type Box[T any] struct {
+	value T   ` + "`required:\"\"`" + `
+	label string
+}
+`,
+			want: `type BoxOption[T any] func(*Box[T])
+
+func WithLabel[T any](label string) BoxOption[T] {`,
+		},
+		{
+			name: "passed on by the pair",
+			src: `package a
+
+//genconstructor -options -pair
+type Foo struct {
+	id   string ` + "`required:\"\"`" + `
+	name string
+}
+`,
+			want: `	foo, err := NewFooE(id, opts...)`,
+		},
+		{
+			name: "struct Opt",
+			src: `package a
+
+//genconstructor -options
+type Opt struct {
+	id   string ` + "`required:\"\"`" + `
+	name string
+}
+`,
+			want: `	newOpt := Opt{
+		id: id,
+	}
+	for _, opt := range opts {
+		opt(&newOpt)
+	}
+	return newOpt`,
+		},
+		{
+			name: "struct Opts",
+			src: `package a
+
+//genconstructor -options
+type Opts struct {
+	id   string ` + "`required:\"\"`" + `
+	name string
+}
+`,
+			want: `	newOpts := Opts{
+		id: id,
+	}
+	for _, opt := range opts {
+		opt(&newOpts)
+	}
+	return newOpts`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "declared option",
+			src: `package a
+
+//genconstructor -options
+type Foo struct {
+	id   string ` + "`required:\"\"`" + `
+	name string
+}
+
+func WithName(name string) {}
+`,
+			want: "option WithName is already declared",
+		},
+		{
+			name: "option of another struct",
+			src: `package a
+
+//genconstructor -options
+type Foo struct {
+	name string
+}
+
+//genconstructor -options
+type Bar struct {
+	name string
+}
+`,
+			want: "option WithName is also generated for Foo",
+		},
+		{
+			name: "opts parameter",
+			src: `package a
+
+//genconstructor -options
+type Foo struct {
+	opts []string ` + "`required:\"\"`" + `
+}
+`,
+			want: "parameter opts collides with the options",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := generate(t, tt.src); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_template(t *testing.T) {
+	src := `package a
+
+import "time"
+
+//genconstructor
+type Foo struct {
+	id      string        ` + "`required:\"\"`" + `
+	timeout time.Duration ` + "`required:\"\"`" + `
+}
+`
+	tmpl := `
+// Make{{ .StructName }} makes a {{ .StructName }}.
+func Make{{ .StructName }}({{ template "params" . }}) *{{ template "result" . }} {
+	return &{{ .StructName }}{ {{- range .Fields }}{{ .Name }}: {{ .ParamName }},{{ end -}} }
+}
+`
+	want := `import (
+	"time"
+)
+
+// MakeFoo makes a Foo.
+func MakeFoo(
+	id string,
+	timeout time.Duration,
+) *Foo {
+	return &Foo{id: id, timeout: timeout}
+}
+`
+	got, err := generate(t, src, genconstructor.WithTemplate(tmpl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	f, err := ioutil.TempFile("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got, err = generate(t, src, genconstructor.WithTemplateFile(f.Name())); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("from file, got:\n%s\nwant suffix:\n%s", got, want)
+	}
+
+	if _, err := generate(t, src, genconstructor.WithTemplate("{{ .StructName")); err == nil || !strings.Contains(err.Error(), "invalid constructor template") {
+		t.Errorf("got %v, want invalid template error", err)
+	}
+}
+
+func TestRun_nilCheck(t *testing.T) {
+	src := `package a
+
+import "io"
+
+type Writer interface {
+	Write(p []byte) (int, error)
+}
+
+//genconstructor %s
+type Foo struct {
+	name   string            ` + "`required:\"\"`" + `
+	r      io.Reader         ` + "`required:\"\"`" + `
+	w      Writer            ` + "`required:\"\"`" + `
+	err    error             ` + "`required:\"\"`" + `
+	next   *Foo              ` + "`required:\"\"`" + `
+	labels map[string]string ` + "`required:\"\"`" + `
+	tags   []string          ` + "`required:\"\"`" + `
+	done   func()            ` + "`required:\"\" nopdefault:\"func() {}\"`" + `
+}
+`
+	for _, tt := range []struct {
+		marker string
+		want   string
+	}{
+		{
+			marker: "-nilcheck",
+			want: `	if w == nil {
+		panic("NewFoo: w must not be nil")
+	}
+	if err == nil {
+		panic("NewFoo: err must not be nil")
+	}
+	if next == nil {
+		panic("NewFoo: next must not be nil")
+	}
+	if labels == nil {
+		panic("NewFoo: labels must not be nil")
+	}
+	return Foo{
+`,
+		},
+		{
+			marker: "-p -nilcheck=error",
+			want: `	if w == nil {
+		var zero *Foo
+		return zero, errors.New("NewFoo: w must not be nil")
+	}
+`,
+		},
+	} {
+		t.Run(tt.marker, func(t *testing.T) {
+			got, err := generate(t, fmt.Sprintf(src, tt.marker))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			// slices are usable when nil, the types of other packages are
+			// not known, and nil funcs are replaced by their nopdefault
+			for _, unchecked := range []string{"tags == nil {\n\t\t", "if r == nil", "done == nil {\n\t\tpanic", "done == nil {\n\t\tvar"} {
+				if strings.Contains(got, unchecked) {
+					t.Errorf("got:\n%s\nwant no check %q", got, unchecked)
+				}
+			}
+		})
+	}
+
+	if _, err := generate(t, fmt.Sprintf(src, "-nilcheck=log")); err == nil || !strings.Contains(err.Error(), `-nilcheck needs panic or error, not "log"`) {
+		t.Errorf("got %v, want invalid -nilcheck error", err)
+	}
+}
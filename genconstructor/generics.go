@@ -0,0 +1,36 @@
+package genconstructor
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// typeParams returns the type parameter list of spec and the type arguments
+// instantiating spec with its own type parameters, or empty strings if spec
+// is not generic. Constraints are printed as they are written, so those
+// declared in the package stay unqualified and need no import.
+func (c *fieldCollector) typeParams(spec *ast.TypeSpec) (string, string, error) {
+	if spec.TypeParams == nil || len(spec.TypeParams.List) == 0 {
+		return "", "", nil
+	}
+
+	params := make([]string, 0, len(spec.TypeParams.List))
+	var args []string
+	for _, field := range spec.TypeParams.List {
+		names := make([]string, 0, len(field.Names))
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		constraint, err := printExpr(field.Type)
+		if err != nil {
+			return "", "", err
+		}
+		if constraint, err = c.qualify(constraint); err != nil {
+			return "", "", err
+		}
+		c.resolveTypeImports(field.Type)
+		params = append(params, strings.Join(names, ", ")+" "+constraint)
+		args = append(args, names...)
+	}
+	return "[" + strings.Join(params, ", ") + "]", "[" + strings.Join(args, ", ") + "]", nil
+}
@@ -0,0 +1,188 @@
+package genconstructor_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRun_generics(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "constraint declared in the package",
+			src: `package a
+
+type Number interface {
+	~int | ~float64
+}
+
+//genconstructor
+type Box[T Number] struct {
+	value T ` + "`required:\"\"`" + `
+}
+`,
+			want: `package a
+
+func NewBox[T Number](
+	value T,
+) Box[T] {
+	return Box[T]{
+		value: value,
+	}
+}
+`,
+		},
+		{
+			name: "multiple type parameters",
+			src: `package a
+
+//genconstructor -p
+type Pair[K comparable, V any] struct {
+	key   K ` + "`required:\"\"`" + `
+	value V ` + "`required:\"\"`" + `
+}
+`,
+			want: `package a
+
+func NewPair[K comparable, V any](
+	key K,
+	value V,
+) *Pair[K, V] {
+	return &Pair[K, V]{
+		key:   key,
+		value: value,
+	}
+}
+`,
+		},
+		{
+			name: "imported constraint",
+			src: `package a
+
+import (
+	"fmt"
+
+	xconstraints "golang.org/x/exp/constraints"
+)
+
+//genconstructor
+type Range[T xconstraints.Ordered, S fmt.Stringer] struct {
+	min   T ` + "`required:\"\"`" + `
+	label S ` + "`required:\"\"`" + `
+}
+`,
+			want: `package a
+
+import (
+	"fmt"
+
+	xconstraints "golang.org/x/exp/constraints"
+)
+
+func NewRange[T xconstraints.Ordered, S fmt.Stringer](
+	min T,
+	label S,
+) Range[T, S] {
+	return Range[T, S]{
+		min:   min,
+		label: label,
+	}
+}
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(got, tt.want) {
+				t.Errorf("got:\n%s\nwant suffix:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRun_mixedGenerics(t *testing.T) {
+	files := map[string]string{
+		"number.go": `package a
+
+import "golang.org/x/exp/constraints"
+
+type Number interface {
+	constraints.Integer | ~float64
+}
+`,
+		"a.go": `package a
+
+import (
+	"time"
+
+	"golang.org/x/exp/constraints"
+)
+
+//genconstructor
+type Box[T Number] struct {
+	value T ` + "`required:\"\"`" + `
+}
+
+//genconstructor -p
+type Foo struct {
+	timeout time.Duration ` + "`required:\"\"`" + `
+}
+
+//genconstructor
+type Max[T constraints.Ordered] struct {
+	values  []T       ` + "`required:\"\"`" + `
+	created time.Time ` + "`required:\"\"`" + `
+}
+`,
+	}
+	got, err := generateFiles(t, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package a
+
+import (
+	"time"
+
+	"golang.org/x/exp/constraints"
+)
+
+func NewBox[T Number](
+	value T,
+) Box[T] {
+	return Box[T]{
+		value: value,
+	}
+}
+
+func NewFoo(
+	timeout time.Duration,
+) *Foo {
+	return &Foo{
+		timeout: timeout,
+	}
+}
+
+func NewMax[T constraints.Ordered](
+	values []T,
+	created time.Time,
+) Max[T] {
+	return Max[T]{
+		values:  values,
+		created: created,
+	}
+}
+`
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+	if strings.Contains(got, "interface") {
+		t.Errorf("constraint is declared again:\n%s", got)
+	}
+}
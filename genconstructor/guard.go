@@ -0,0 +1,53 @@
+package genconstructor
+
+import (
+	"go/ast"
+)
+
+// WithUsageGuards declares var _ = newFoo for each unexported function
+// generated for a struct, such as the constructors of -unexported, so that
+// linters do not report the ones only called by tests as unused. Generic
+// functions are not guarded, as they cannot be referred to uninstantiated.
+func WithUsageGuards() Option {
+	return func(o *option) {
+		o.usageGuards = true
+	}
+}
+
+// guards returns the names of the unexported functions generated for
+// the struct of p, in the order they are declared.
+func (o option) guards(p tmplParam) []string {
+	if p.TypeParams != "" {
+		return nil
+	}
+	var names []string
+	if p.Pair {
+		names = append(names, p.FuncName+"E")
+	}
+	names = append(names, p.FuncName)
+	if p.ReturnsError && !p.Pair {
+		names = append(names, p.MustName)
+	}
+	if p.From != nil {
+		names = append(names, p.FuncName+"From"+o.upperCamel(p.From.Type))
+	}
+	if p.Factory != nil {
+		names = append(names, p.Factory.FuncName)
+	}
+	if p.DoProvider != nil {
+		names = append(names, p.DoProvider.Name)
+	}
+	if p.DoFactoryProvider != nil {
+		names = append(names, p.DoFactoryProvider.Name)
+	}
+	if p.Reconstruct != nil {
+		names = append(names, p.Reconstruct.Name)
+	}
+	var guards []string
+	for _, name := range names {
+		if !ast.IsExported(name) {
+			guards = append(guards, name)
+		}
+	}
+	return guards
+}
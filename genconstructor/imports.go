@@ -0,0 +1,190 @@
+package genconstructor
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fmtImports formats importPackages, a map from package name to import path,
+// as import declarations for a file of the package pkgPath.
+// Standard library packages are grouped before the others, and the cgo
+// pseudo-package C gets a declaration of its own.
+func fmtImports(importPackages map[string]string, pkgPath string) string {
+	var std, others []string
+	hasC := false
+	for name, importPath := range importPackages {
+		spec := fmt.Sprintf("%q", importPath)
+		switch {
+		case strings.HasPrefix(name, "."):
+			// dot imports are keyed by their path, as in dotImportKey
+			spec = ". " + spec
+		case importedName(importPath) != name:
+			spec = name + " " + spec
+		}
+		switch {
+		case importPath == "C":
+			hasC = true
+		case isStdlib(importPath, pkgPath):
+			std = append(std, spec)
+		default:
+			others = append(others, spec)
+		}
+	}
+	sort.Slice(std, func(i, j int) bool { return importSpecPath(std[i]) < importSpecPath(std[j]) })
+	sort.Slice(others, func(i, j int) bool { return importSpecPath(others[i]) < importSpecPath(others[j]) })
+
+	b := new(bytes.Buffer)
+	if hasC {
+		b.WriteString("import \"C\"\n\n")
+	}
+	if len(std) == 0 && len(others) == 0 {
+		return b.String()
+	}
+	b.WriteString("import (\n")
+	for _, spec := range std {
+		fmt.Fprintf(b, "\t%s\n", spec)
+	}
+	if len(std) > 0 && len(others) > 0 {
+		b.WriteString("\n")
+	}
+	for _, spec := range others {
+		fmt.Fprintf(b, "\t%s\n", spec)
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
+
+// isStdlib reports whether importPath looks like a standard library package:
+// its first element is not a domain name and it is not a package of the same
+// module as pkgPath (e.g. myapp/util from myapp/foo).
+func isStdlib(importPath, pkgPath string) bool {
+	first := strings.SplitN(importPath, "/", 2)[0]
+	if strings.Contains(first, ".") {
+		return false
+	}
+	return first != strings.SplitN(pkgPath, "/", 2)[0]
+}
+
+func importSpecPath(spec string) string {
+	return spec[strings.Index(spec, `"`):]
+}
+
+// dotImportKey returns the key of the dot import of importPath in a map
+// from package name to import path such as the one of fmtImports.
+func dotImportKey(importPath string) string {
+	return "." + importPath
+}
+
+// fileImports returns the packages imported by file by the name they are
+// referred to with. Dot and blank imports are left out. An import whose
+// package name is not the one guessed from its path is known by the name
+// the file refers to it with, if it is the only such import and name.
+func fileImports(file *ast.File) map[string]string {
+	imports := make(map[string]string, len(file.Imports))
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importedName(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name == "." || name == "_" {
+			continue
+		}
+		imports[name] = importPath
+	}
+
+	// package names are unresolved by the parser
+	referenced := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				referenced[ident.Name] = true
+			}
+		}
+		return true
+	})
+	var unknown, unreferenced []string
+	for name := range referenced {
+		if _, ok := imports[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	for _, spec := range file.Imports {
+		if spec.Name != nil {
+			continue
+		}
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err == nil && importPath != "C" && !referenced[importedName(importPath)] {
+			unreferenced = append(unreferenced, importPath)
+		}
+	}
+	if len(unknown) == 1 && len(unreferenced) == 1 {
+		delete(imports, importedName(unreferenced[0]))
+		imports[unknown[0]] = unreferenced[0]
+	}
+	return imports
+}
+
+// dotImports returns the packages dot-imported by file.
+func dotImports(file *ast.File) []string {
+	var dots []string
+	for _, spec := range file.Imports {
+		if spec.Name == nil || spec.Name.Name != "." {
+			continue
+		}
+		if importPath, err := strconv.Unquote(spec.Path.Value); err == nil {
+			dots = append(dots, importPath)
+		}
+	}
+	return dots
+}
+
+var versionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// importedName guesses the name of the package at importPath the way
+// goimports does: the last element, skipping a major version element, and
+// without a go- prefix or a .vN suffix (gopkg.in).
+func importedName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if versionSuffix.MatchString(name) && len(elems) > 1 {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// exprImports returns the packages of imports which expr refers to through
+// selectors such as time.Second.
+func exprImports(expr ast.Expr, imports map[string]string) map[string]string {
+	used := make(map[string]string)
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			if importPath, ok := imports[ident.Name]; ok {
+				used[ident.Name] = importPath
+			}
+		}
+		return true
+	})
+	return used
+}
@@ -0,0 +1,104 @@
+package genconstructor
+
+import "testing"
+
+func TestFmtImports(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		importPackages map[string]string
+		pkgPath        string
+		want           string
+	}{
+		{
+			name:           "empty",
+			importPackages: map[string]string{},
+			pkgPath:        "myapp/foo",
+			want:           "",
+		},
+		{
+			name: "grouped",
+			importPackages: map[string]string{
+				"fmt":  "fmt",
+				"y":    "github.com/x/y",
+				"util": "myapp/util",
+			},
+			pkgPath: "myapp/foo",
+			want: `import (
+	"fmt"
+
+	"github.com/x/y"
+	"myapp/util"
+)
+`,
+		},
+		{
+			name: "named and versioned",
+			importPackages: map[string]string{
+				"http":  "net/http",
+				"yaml":  "gopkg.in/yaml.v2",
+				"chi":   "github.com/go-chi/chi/v5",
+				"ctxpb": "example.com/ctx",
+			},
+			pkgPath: "example.com/foo",
+			want: `import (
+	"net/http"
+
+	ctxpb "example.com/ctx"
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v2"
+)
+`,
+		},
+		{
+			name: "cgo",
+			importPackages: map[string]string{
+				"C":    "C",
+				"time": "time",
+			},
+			pkgPath: "github.com/x/foo",
+			want: `import "C"
+
+import (
+	"time"
+)
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmtImports(tt.importPackages, tt.pkgPath); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsStdlib(t *testing.T) {
+	for _, tt := range []struct {
+		importPath string
+		want       bool
+	}{
+		{"fmt", true},
+		{"net/http", true},
+		{"github.com/x/y", false},
+		{"myapp/util", false},
+	} {
+		if got := isStdlib(tt.importPath, "myapp/foo"); got != tt.want {
+			t.Errorf("isStdlib(%q) = %v, want %v", tt.importPath, got, tt.want)
+		}
+	}
+}
+
+func TestImportedName(t *testing.T) {
+	for importPath, want := range map[string]string{
+		"fmt":                      "fmt",
+		"net/http":                 "http",
+		"github.com/go-chi/chi/v5": "chi",
+		"gopkg.in/yaml.v2":         "yaml",
+		"github.com/x/go-strcase":  "strcase",
+		"example.com/foo-bar":      "foo_bar",
+	} {
+		if got := importedName(importPath); got != want {
+			t.Errorf("importedName(%q) = %q, want %q", importPath, got, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package genconstructor
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/hori-ryota/go-strcase"
+)
+
+// WithInitialisms makes the names generated from the names of fields and
+// structs, such as getters, options and constructors, spell words as the
+// given initialisms, e.g. "SKU" for WithSKU and SKU() rather than WithSku
+// and Sku(), on top of the common ones such as ID and URL.
+func WithInitialisms(words ...string) Option {
+	return func(o *option) {
+		if o.initialisms == nil {
+			o.initialisms = make(map[string]bool, len(words))
+		}
+		for _, w := range words {
+			o.initialisms[strings.ToUpper(w)] = true
+		}
+	}
+}
+
+// applyInitialisms returns the upper camel case name with its words found
+// in initialisms upper-cased.
+func applyInitialisms(name string, initialisms map[string]bool) string {
+	if len(initialisms) == 0 {
+		return name
+	}
+	var b strings.Builder
+	for _, w := range camelWords(name) {
+		if u := strings.ToUpper(w); initialisms[u] {
+			w = u
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
+
+// upperCamel is strcase.ToUpperCamel keeping the words s spells upper-cased,
+// e.g. NewOrderDTO rather than NewOrderDto from OrderDTO, and spelling
+// initialisms.
+func upperCamel(s string, initialisms map[string]bool) string {
+	return applyInitialisms(applyInitialisms(strcase.ToUpperCamel(s), spelledWords(s)), initialisms)
+}
+
+// lowerCamel is strcase.ToLowerCamel keeping the words but the first one s
+// spells upper-cased, e.g. orderDTO from OrderDTO.
+func lowerCamel(s string) string {
+	name := strcase.ToLowerCamel(s)
+	words := camelWords(name)
+	if len(words) < 2 {
+		return name
+	}
+	return words[0] + applyInitialisms(strings.Join(words[1:], ""), spelledWords(s))
+}
+
+// spelledWords returns the words of the camel case name spelled
+// upper-cased, such as DTO in OrderDTO.
+func spelledWords(name string) map[string]bool {
+	var words map[string]bool
+	for _, w := range camelWords(name) {
+		if len(w) < 2 || strings.ToUpper(w) != w || strings.ToLower(w) == w {
+			continue
+		}
+		if words == nil {
+			words = make(map[string]bool)
+		}
+		words[w] = true
+	}
+	return words
+}
+
+// camelWords splits the camel case name into its words, e.g. "HTTPServer2Sku"
+// into "HTTP", "Server2" and "Sku".
+func camelWords(name string) []string {
+	rs := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i < len(rs); i++ {
+		if !unicode.IsUpper(rs[i]) {
+			continue
+		}
+		prev := rs[i-1]
+		if !unicode.IsUpper(prev) || i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+			words = append(words, string(rs[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(rs[start:]))
+}
@@ -0,0 +1,113 @@
+package genconstructor
+
+import (
+	"go/build/constraint"
+	"io"
+	"sort"
+	"strconv"
+	"text/template"
+)
+
+// WithManifest makes Run also write a file of the package at pkgPath into
+// the writer newWriter returns, importing the constructors generated by the
+// run and registering them by type:
+//
+//	var Constructors = map[string]any{
+//		"example.com/a.Foo": a.NewFoo,
+//	}
+//
+// Constructors of generic structs cannot be referred to without type
+// arguments and are left out.
+func WithManifest(pkgPath string, newWriter func() io.Writer) Option {
+	return func(o *option) {
+		o.manifest = &manifest{pkgPath: pkgPath, newWriter: newWriter}
+	}
+}
+
+// manifest collects the constructors generated by a run for the manifest
+// file.
+type manifest struct {
+	pkgPath   string
+	newWriter func() io.Writer
+
+	entries     []manifestEntry
+	constraints []constraint.Expr
+}
+
+// manifestEntry is a constructor registered by the manifest.
+type manifestEntry struct {
+	// PkgPath and PkgName are the package declaring the constructor.
+	PkgPath     string
+	PkgName     string
+	StructName  string
+	Constructor string
+}
+
+// add registers the constructors of entries, declared by the package
+// pkgPath named pkgName and guarded by the build constraint expr.
+func (m *manifest) add(pkgPath, pkgName string, entries []manifestEntry, expr constraint.Expr) {
+	for _, e := range entries {
+		e.PkgPath, e.PkgName = pkgPath, pkgName
+		m.entries = append(m.entries, e)
+	}
+	m.constraints = append(m.constraints, expr)
+}
+
+// file returns the template data of the manifest file, importing each
+// package by its name, numbered when several packages share it.
+func (m *manifest) file() map[string]interface{} {
+	pkgName := importedName(m.pkgPath)
+	importPackages := make(map[string]string)
+	names := make(map[string]string)
+	sort.Slice(m.entries, func(i, j int) bool {
+		if m.entries[i].PkgPath != m.entries[j].PkgPath {
+			return m.entries[i].PkgPath < m.entries[j].PkgPath
+		}
+		return m.entries[i].StructName < m.entries[j].StructName
+	})
+	type entry struct {
+		Key         string
+		Constructor string
+	}
+	entries := make([]entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		ref := e.Constructor
+		if e.PkgPath != m.pkgPath {
+			name, ok := names[e.PkgPath]
+			if !ok {
+				name = e.PkgName
+				for n := 2; name == pkgName || importPackages[name] != ""; n++ {
+					name = e.PkgName + strconv.Itoa(n)
+				}
+				importPackages[name] = e.PkgPath
+				names[e.PkgPath] = name
+			}
+			ref = name + "." + e.Constructor
+		}
+		entries = append(entries, entry{Key: e.PkgPath + "." + e.StructName, Constructor: ref})
+	}
+	return map[string]interface{}{
+		"PackageName":    pkgName,
+		"ImportPackages": fmtImports(importPackages, m.pkgPath),
+		"Entries":        entries,
+	}
+}
+
+// manifestTmpl renders the manifest file.
+var manifestTmpl = template.Must(template.New("manifest").Parse(`
+			{{ if .Header }}// Code generated by {{ .GeneratorName }}; DO NOT EDIT.{{ end }}
+
+			{{ .BuildConstraint }}
+
+			package {{ .PackageName }}
+
+			{{ .ImportPackages }}
+
+			// Constructors are the generated constructors by import path and
+			// name of the type they construct.
+			var Constructors = map[string]any{
+				{{- range .Entries }}
+				"{{ .Key }}": {{ .Constructor }},
+				{{- end }}
+			}
+		`))
@@ -0,0 +1,42 @@
+package genconstructor
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestManifestFile(t *testing.T) {
+	specs := func(names ...string) []manifestEntry {
+		entries := make([]manifestEntry, 0, len(names))
+		for _, name := range names {
+			entries = append(entries, manifestEntry{StructName: name, Constructor: "New" + name})
+		}
+		return entries
+	}
+	m := &manifest{pkgPath: "example.com/app/registry"}
+	m.add("example.com/lib/user", "user", specs("Client"), nil)
+	m.add("example.com/app/user", "user", specs("User", "Group"), nil)
+	m.add("example.com/app/registry/registry", "registry", specs("Entry"), nil)
+	m.add("example.com/app/registry", "registry", specs("Local"), nil)
+
+	data := m.file()
+	wantImports := `import (
+	registry2 "example.com/app/registry/registry"
+	"example.com/app/user"
+	user2 "example.com/lib/user"
+)
+`
+	if got := data["ImportPackages"]; got != wantImports {
+		t.Errorf("imports:\n%s\nwant:\n%s", got, wantImports)
+	}
+	wantEntries := "[" +
+		"{example.com/app/registry.Local NewLocal} " +
+		"{example.com/app/registry/registry.Entry registry2.NewEntry} " +
+		"{example.com/app/user.Group user.NewGroup} " +
+		"{example.com/app/user.User user.NewUser} " +
+		"{example.com/lib/user.Client user2.NewClient}" +
+		"]"
+	if got := fmt.Sprint(data["Entries"]); got != wantEntries {
+		t.Errorf("entries:\n%s\nwant:\n%s", got, wantEntries)
+	}
+}
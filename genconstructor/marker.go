@@ -0,0 +1,238 @@
+package genconstructor
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// markerOptions are the options given on the marker comment of a struct.
+type markerOptions struct {
+	pointer     bool
+	super       bool
+	extends     bool
+	namedReturn bool
+	flatten     bool
+
+	validateMethod bool
+	getters        bool
+	proto          bool
+	pair           bool
+	options        bool
+	// returnsError makes the constructor return an error (-pair, -error),
+	// the one of Validate and of errorMethod, a method of the struct
+	// declared in the package (-error=method), if given.
+	returnsError bool
+	errorMethod  string
+	// nilCheck is "panic" or "error" when the constructor checks its
+	// nilable parameters for nil (-nilcheck), or empty.
+	nilCheck string
+
+	// returnType is the type the constructor returns the struct as
+	// (-return=Type or -as Type), if any.
+	returnType string
+	// from is the struct a conversion constructor is generated from
+	// (-from=Type), if any.
+	from string
+	// name is the name of the constructor instead of NewFoo (-name=Name or
+	// -name Name), if any.
+	name string
+	// unexported makes the constructor newFoo (-unexported).
+	unexported bool
+	// all makes every field without tags a parameter (-all).
+	all bool
+	// copy makes the slice and map parameters copied (-copy).
+	copy bool
+	// reconstruct generates ReconstructFoo taking every field
+	// (-reconstruct).
+	reconstruct bool
+	// factory generates FooFactory holding the dependencies of NewFoo
+	// (-factory).
+	factory bool
+
+	// accessors reports whether the struct is marked with //genaccessor as
+	// well, the getter tags of which are then left to go-genaccessor.
+	accessors bool
+}
+
+// accessorMarker is the marker of go-genaccessor.
+const accessorMarker = "//genaccessor"
+
+// hasAccessorMarker reports whether docs mark the struct for
+// go-genaccessor.
+func hasAccessorMarker(docs []*ast.Comment) bool {
+	for _, comment := range docs {
+		if _, kubebuilder, ok := markerFields(comment.Text, accessorMarker); ok && !kubebuilder {
+			return true
+		}
+	}
+	return false
+}
+
+// kubebuilderOpts are the options of the markers in the style of
+// controller-gen, e.g. // +genconstructor:pointer, named otherwise than
+// those of the marker without their "-".
+var kubebuilderOpts = map[string]string{
+	"pointer": pointerOpts,
+	"super":   superOpts,
+	"extends": extendsOpts,
+}
+
+// markerFields returns the options of comment if it is a marker: a comment
+// starting with prefix, e.g. //genconstructor -p, or a marker in the style
+// of controller-gen, such as // +genconstructor or, with an option,
+// // +genconstructor:pointer and // +genconstructor:name=BuildOrder.
+func markerFields(comment, prefix string) (fields []string, kubebuilder, ok bool) {
+	if strings.HasPrefix(strings.TrimSpace(comment), prefix) {
+		return strings.Fields(comment)[1:], false, true
+	}
+	name := "+" + strings.TrimPrefix(prefix, "//")
+	text := strings.Fields(strings.TrimPrefix(comment, "//"))
+	if len(text) == 0 || text[0] != name && !strings.HasPrefix(text[0], name+":") {
+		return nil, false, false
+	}
+	if opt := strings.TrimPrefix(text[0], name); opt != "" {
+		opt = opt[1:]
+		key, value, hasValue := strings.Cut(opt, "=")
+		if o, ok := kubebuilderOpts[key]; ok {
+			key = o
+		} else {
+			key = "-" + key
+		}
+		if hasValue {
+			key += "=" + value
+		}
+		fields = append(fields, key)
+	}
+	return append(fields, text[1:]...), true, true
+}
+
+// parseMarker looks for the comment starting with prefix in docs and parses
+// its options, following the options defaults every marker has. The markers
+// in the style of controller-gen are all read, each adding its option, but
+// only the first of the others. unknown is called for each option starting
+// with "-" that is not recognized.
+func parseMarker(docs []*ast.Comment, prefix string, defaults []string, unknown func(comment *ast.Comment, opt string)) (markerOptions, bool) {
+	// fields are the options of the markers, and comments the marker each
+	// comes from
+	var fields []string
+	var comments []*ast.Comment
+	marked, found := false, false
+	for _, comment := range docs {
+		opts, kubebuilder, ok := markerFields(comment.Text, prefix)
+		if !ok || found && !kubebuilder {
+			continue
+		}
+		if !marked {
+			for _, opt := range defaults {
+				fields = append(fields, opt)
+				comments = append(comments, comment)
+			}
+		}
+		marked = true
+		found = found || !kubebuilder
+		for _, opt := range opts {
+			fields = append(fields, opt)
+			comments = append(comments, comment)
+		}
+	}
+	if !marked {
+		return markerOptions{}, false
+	}
+
+	var marker markerOptions
+	for i := 0; i < len(fields); i++ {
+		s, comment := fields[i], comments[i]
+		switch s {
+		case pointerOpts:
+			marker.pointer = true
+		case superOpts:
+			marker.super = true
+		case extendsOpts:
+			marker.extends = true
+		case namedReturnOpts:
+			marker.namedReturn = true
+		case flattenOpts:
+			marker.flatten = true
+		case validateMethodOpts:
+			marker.validateMethod = true
+		case gettersOpts, longGettersOpts:
+			marker.getters = true
+		case protoOpts:
+			// messages are used through pointers
+			marker.proto = true
+			marker.pointer = true
+		case pairOpts:
+			// NewFooE returns the error of Validate
+			marker.pair = true
+			marker.returnsError = true
+			marker.validateMethod = true
+		case optionsOpts:
+			marker.options = true
+		case errorOpts:
+			marker.returnsError = true
+			marker.validateMethod = true
+		case unexportedOpts:
+			marker.unexported = true
+		case allOpts:
+			marker.all = true
+		case copyOpts:
+			marker.copy = true
+		case reconstructOpts:
+			marker.reconstruct = true
+		case factoryOpts:
+			marker.factory = true
+		case nameOpts:
+			// -name BuildOrder
+			if i+1 == len(fields) {
+				unknown(comment, s)
+				continue
+			}
+			i++
+			marker.name = fields[i]
+		case asOpts:
+			// -as OrderRepository, the same as -return=OrderRepository
+			if i+1 == len(fields) {
+				unknown(comment, s)
+				continue
+			}
+			i++
+			marker.returnType = fields[i]
+		default:
+			if strings.HasPrefix(s, returnOpts+"=") {
+				marker.returnType = strings.TrimPrefix(s, returnOpts+"=")
+				continue
+			}
+			if strings.HasPrefix(s, asOpts+"=") {
+				marker.returnType = strings.TrimPrefix(s, asOpts+"=")
+				continue
+			}
+			if strings.HasPrefix(s, errorOpts+"=") {
+				marker.returnsError = true
+				marker.errorMethod = strings.TrimPrefix(s, errorOpts+"=")
+				continue
+			}
+			if s == nilCheckOpts || strings.HasPrefix(s, nilCheckOpts+"=") {
+				marker.nilCheck = "panic"
+				if v := strings.TrimPrefix(s, nilCheckOpts); v != "" {
+					marker.nilCheck = strings.TrimPrefix(v, "=")
+				}
+				if marker.nilCheck == "error" {
+					marker.returnsError = true
+				}
+				continue
+			}
+			if strings.HasPrefix(s, nameOpts+"=") {
+				marker.name = strings.TrimPrefix(s, nameOpts+"=")
+				continue
+			}
+			if strings.HasPrefix(s, fromOpts+"=") {
+				marker.from = strings.TrimPrefix(s, fromOpts+"=")
+				continue
+			}
+			if strings.HasPrefix(s, "-") {
+				unknown(comment, s)
+			}
+		}
+	}
+	return marker, true
+}
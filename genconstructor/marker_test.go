@@ -0,0 +1,89 @@
+package genconstructor
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestParseMarker_crlf(t *testing.T) {
+	for _, text := range []string{
+		"//genconstructor -p\r",
+		"//genconstructor -p -named-return\r",
+	} {
+		marker, ok := parseMarker([]*ast.Comment{{Text: text}}, commentMarker, nil, func(comment *ast.Comment, opt string) {
+			t.Errorf("%q: unknown option %q", text, opt)
+		})
+		if !ok {
+			t.Errorf("%q: marker not found", text)
+			continue
+		}
+		if !marker.pointer {
+			t.Errorf("%q: pointer option not detected", text)
+		}
+	}
+}
+
+func TestParseMarker_name(t *testing.T) {
+	for _, text := range []string{
+		"//genconstructor -name BuildOrder -p",
+		"//genconstructor -name=BuildOrder -p",
+	} {
+		marker, _ := parseMarker([]*ast.Comment{{Text: text}}, commentMarker, nil, func(comment *ast.Comment, opt string) {
+			t.Errorf("%q: unknown option %q", text, opt)
+		})
+		if marker.name != "BuildOrder" || !marker.pointer {
+			t.Errorf("%q: got %+v", text, marker)
+		}
+	}
+
+	var unknown []string
+	parseMarker([]*ast.Comment{{Text: "//genconstructor -name"}}, commentMarker, nil, func(comment *ast.Comment, opt string) {
+		unknown = append(unknown, opt)
+	})
+	if len(unknown) != 1 || unknown[0] != "-name" {
+		t.Errorf("unknown options = %q, want [-name]", unknown)
+	}
+}
+
+func TestParseMarker_kubebuilder(t *testing.T) {
+	for _, tt := range []struct {
+		docs []string
+		want markerOptions
+	}{
+		{docs: []string{"// +genconstructor"}},
+		{docs: []string{"// +genconstructor:pointer"}, want: markerOptions{pointer: true}},
+		{
+			docs: []string{"// Foo is a foo.", "// +genconstructor", "// +genconstructor:pointer", "// +genconstructor:name=BuildFoo"},
+			want: markerOptions{pointer: true, name: "BuildFoo"},
+		},
+		{docs: []string{"//+genconstructor:getters"}, want: markerOptions{getters: true}},
+		{docs: []string{"// +genconstructor:as=io.Reader"}, want: markerOptions{returnType: "io.Reader"}},
+		{docs: []string{"//genconstructor -g", "// +genconstructor:pointer"}, want: markerOptions{getters: true, pointer: true}},
+	} {
+		var docs []*ast.Comment
+		for _, text := range tt.docs {
+			docs = append(docs, &ast.Comment{Text: text})
+		}
+		marker, ok := parseMarker(docs, commentMarker, nil, func(comment *ast.Comment, opt string) {
+			t.Errorf("%q: unknown option %q", tt.docs, opt)
+		})
+		if !ok {
+			t.Errorf("%q: marker not found", tt.docs)
+			continue
+		}
+		if marker != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.docs, marker, tt.want)
+		}
+	}
+
+	var unknown []string
+	parseMarker([]*ast.Comment{{Text: "// +genconstructor:bogus"}}, commentMarker, nil, func(comment *ast.Comment, opt string) {
+		unknown = append(unknown, opt)
+	})
+	if len(unknown) != 1 || unknown[0] != "-bogus" {
+		t.Errorf("unknown options = %q, want [-bogus]", unknown)
+	}
+	if _, ok := parseMarker([]*ast.Comment{{Text: "// +genconstructors"}}, commentMarker, nil, nil); ok {
+		t.Error("// +genconstructors taken for a marker")
+	}
+}
@@ -0,0 +1,25 @@
+package genconstructor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ModulePath returns the path of the module directive of the go.mod file
+// data, or "" if there is none.
+func ModulePath(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		if p, err := strconv.Unquote(fields[1]); err == nil {
+			return p
+		}
+		return fields[1]
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package genconstructor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+
+	"github.com/hori-ryota/go-strcase"
+)
+
+// optionsParam is the name of the variadic parameter of a constructor taking
+// functional options (-options).
+const optionsParam = "opts"
+
+// optionSet is the functional options of a constructor (-options): the type
+// of the options and a function per field not taken by the constructor.
+type optionSet struct {
+	// TypeName is the name of the option type, e.g. FooOption.
+	TypeName string
+	Funcs    []optionFunc
+}
+
+// optionFunc is the option setting Field, e.g. WithName.
+type optionFunc struct {
+	Name  string
+	Field FieldInfo
+}
+
+// options returns the functional options of the struct structName, set
+// from the named fields of structType which are not in fields, the ones
+// the constructor sets, nor tagged with ctorignore, and from the fields
+// with a default tag. Embedded fields are left out.
+func (c *fieldCollector) options(structName string, structType *ast.StructType, fields []FieldInfo) (*optionSet, error) {
+	set := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		set[f.Name] = !f.Optional
+	}
+	options := &optionSet{TypeName: c.upperCamel(structName) + "Option"}
+	for _, field := range structType.Fields.List {
+		if len(field.Names) == 0 {
+			continue
+		}
+		if field.Tag != nil {
+			// the tags are checked when the fields are collected
+			tag, _ := strconv.Unquote(field.Tag.Value)
+			if tags, _, _ := parseFieldTags(reflect.StructTag(tag), c.requiredKey, nil); tags.ignore {
+				continue
+			}
+		}
+		typ, err := printExpr(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range field.Names {
+			if name.Name == "_" || set[name.Name] {
+				continue
+			}
+			paramName := strcase.ToLowerCamel(name.Name)
+			// x is the struct the option is applied to
+			if token.Lookup(paramName).IsKeyword() || paramName == "x" {
+				paramName = "v"
+			}
+			options.Funcs = append(options.Funcs, optionFunc{
+				Name:  "With" + c.upperCamel(name.Name),
+				Field: FieldInfo{Type: typ, Name: name.Name, Kind: KindParameter, ParamName: paramName, pos: name.Pos()},
+			})
+		}
+		c.resolveTypeImports(field.Type)
+	}
+	return options, nil
+}
+
+// declareOptions returns an error if a name of options is declared by the
+// package or generated for another struct, and records them otherwise.
+func (c *fieldCollector) declareOptions(structName string, options *optionSet) error {
+	if c.optionNames == nil {
+		c.optionNames = make(map[string]string)
+	}
+	names := []string{options.TypeName}
+	for _, f := range options.Funcs {
+		names = append(names, f.Name)
+	}
+	for _, name := range names {
+		if decl, ok := c.scope.decls[name]; ok && c.qualifier == "" {
+			return fmt.Errorf("option %s is already declared at %s", name, c.walker.FileSet.Position(decl.pos))
+		}
+		if other, ok := c.optionNames[name]; ok {
+			return fmt.Errorf("option %s is also generated for %s", name, other)
+		}
+	}
+	for _, name := range names {
+		c.optionNames[name] = structName
+	}
+	return nil
+}
+
+// optionFields returns the fields set by options.
+func (s *optionSet) optionFields() []FieldInfo {
+	fields := make([]FieldInfo, 0, len(s.Funcs))
+	for _, f := range s.Funcs {
+		fields = append(fields, f.Field)
+	}
+	return fields
+}
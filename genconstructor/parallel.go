@@ -0,0 +1,93 @@
+package genconstructor
+
+import (
+	"go/build/constraint"
+	"sync"
+	"sync/atomic"
+)
+
+// WithJobs makes Run generate for up to n packages at once, e.g. those of a
+// pattern such as ./..., instead of one after another. The writers of Run
+// and of the options, and the plugins, are then called concurrently for
+// different packages and must be safe for that. Diagnostics are reported in
+// the order of the packages either way.
+func WithJobs(n int) Option {
+	return func(o *option) {
+		o.jobs = n
+	}
+}
+
+// pkgResult is what generating a package reports to Run.
+type pkgResult struct {
+	diagnostics []Diagnostic
+	manifest    []manifestAdd
+}
+
+func (r *pkgResult) report(d Diagnostic) {
+	r.diagnostics = append(r.diagnostics, d)
+}
+
+// manifestAdd are the arguments of a manifest.add call.
+type manifestAdd struct {
+	pkgPath string
+	pkgName string
+	entries []manifestEntry
+	expr    constraint.Expr
+}
+
+// forEachPackage calls generate for each of n packages, on up to jobs of
+// them at once, and apply with the result of each in order. It returns the
+// first error of generate in the order of the packages, after which the
+// packages not started yet are left out.
+func forEachPackage(n, jobs int, generate func(i int, res *pkgResult) error, apply func(res *pkgResult)) error {
+	if jobs <= 1 {
+		for i := 0; i < n; i++ {
+			var res pkgResult
+			err := generate(i, &res)
+			apply(&res)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	results := make([]pkgResult, n)
+	errs := make([]error, n)
+	done := make([]chan struct{}, n)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	var stopped int32
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if atomic.LoadInt32(&stopped) == 0 {
+					errs[i] = generate(i, &results[i])
+				}
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			next <- i
+		}
+		close(next)
+	}()
+
+	var err error
+	for i := 0; i < n && err == nil; i++ {
+		<-done[i]
+		apply(&results[i])
+		if err = errs[i]; err != nil {
+			atomic.StoreInt32(&stopped, 1)
+		}
+	}
+	wg.Wait()
+	return err
+}
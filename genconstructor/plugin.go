@@ -0,0 +1,49 @@
+package genconstructor
+
+// GenContext describes a marked struct to a plugin generating code for it.
+type GenContext struct {
+	StructName string
+	// TypeParams and TypeArgs are the type parameter list of a generic
+	// struct and the type arguments instantiating it with them, such as
+	// "[K comparable, V any]" and "[K, V]", or empty.
+	TypeParams string
+	TypeArgs   string
+	// Fields are the fields set by the constructor, and Params the ones
+	// taken as its parameters, in parameter order.
+	Fields []FieldInfo
+	Params []FieldInfo
+	// Pointer reports whether the constructor returns a pointer (-p).
+	Pointer bool
+	// AddImport makes the generated file import the package at importPath
+	// by name, or by the last element of importPath if name is empty.
+	AddImport func(name, importPath string)
+}
+
+// WithPlugin makes plugin generate code for each marked struct, appended
+// to the constructor of the struct in the generated file, e.g. a Reset
+// method. The code is formatted with the rest of the file. Plugins are run
+// in the order they are given.
+func WithPlugin(plugin func(GenContext) ([]byte, error)) Option {
+	return func(o *option) {
+		o.plugins = append(o.plugins, plugin)
+	}
+}
+
+// genContext returns the GenContext of the constructor p, adding imports to
+// collector.
+func (p tmplParam) genContext(collector *fieldCollector) GenContext {
+	return GenContext{
+		StructName: p.StructName,
+		TypeParams: p.TypeParams,
+		TypeArgs:   p.TypeArgs,
+		Fields:     p.Fields,
+		Params:     p.Params,
+		Pointer:    p.Pointer,
+		AddImport: func(name, importPath string) {
+			if name == "" {
+				name = importedName(importPath)
+			}
+			collector.addImport(name, importPath)
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package genconstructor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+
+	"github.com/GuiltyMorishita/go-genutil/genutil"
+	"github.com/hori-ryota/go-strcase"
+)
+
+// reconstructor is the function setting every field of a struct from its
+// parameters as is (-reconstruct), e.g. ReconstructOrder, for the values
+// stored by the application such as the rows of a database. Unlike the
+// constructor it takes the fields set to constants or left out, and
+// neither transforms nor validates them.
+type reconstructor struct {
+	Name   string
+	Fields []FieldInfo
+}
+
+// reconstructorName returns the name of the reconstructor of the struct
+// structName, unexported as the constructor is.
+func (o option) reconstructorName(structName string, marker markerOptions) string {
+	if marker.unexported {
+		return "reconstruct" + o.upperCamel(structName)
+	}
+	return "Reconstruct" + o.upperCamel(structName)
+}
+
+// reconstructor returns the reconstructor name of the struct structName,
+// taking each field of structType but the blank ones, embedded fields
+// included, in their order.
+func (c *fieldCollector) reconstructor(name string, structType *ast.StructType) (*reconstructor, error) {
+	r := &reconstructor{Name: name}
+	params := make(map[string]string)
+	for _, field := range splitFieldNames(structType.Fields.List) {
+		fieldName := genutil.ParseFieldName(field)
+		if fieldName == "_" {
+			continue
+		}
+		typ, err := printExpr(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		paramName := strcase.ToLowerCamel(fieldName)
+		if token.Lookup(paramName).IsKeyword() {
+			paramName += "Value"
+		}
+		if other, ok := params[paramName]; ok {
+			return nil, fmt.Errorf("fields %s and %s are both reconstructed from parameter %s", other, fieldName, paramName)
+		}
+		params[paramName] = fieldName
+		r.Fields = append(r.Fields, FieldInfo{Type: typ, Name: fieldName, Kind: KindParameter, ParamName: paramName, pos: field.Pos()})
+		c.resolveTypeImports(field.Type)
+	}
+	return r, nil
+}
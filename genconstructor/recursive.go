@@ -0,0 +1,85 @@
+package genconstructor
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WithExcludedDirs makes Run skip the directories matching one of patterns
+// below the root of a pattern such as ./..., and the directories below
+// them. A pattern with a slash, e.g. "internal/legacy" or "api/*/mocks",
+// is matched by path.Match against the slash-separated path relative to
+// the root, and one without against the directory name, e.g. "mocks".
+func WithExcludedDirs(patterns ...string) Option {
+	return func(o *option) {
+		o.excludedDirs = append(o.excludedDirs, patterns...)
+	}
+}
+
+// recursiveRoot returns the directory of a pattern such as "./..." or
+// "internal/...", matching it and every directory below.
+func recursiveRoot(pattern string) (string, bool) {
+	if pattern != "..." && !strings.HasSuffix(pattern, "/...") {
+		return "", false
+	}
+	root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	if root == "" {
+		root = "."
+	}
+	return filepath.FromSlash(root), true
+}
+
+// packageDirs returns root and the directories below it, skipping vendor
+// and testdata directories, those matching a pattern of excluded and, as
+// the go command does, those whose names start with "." or "_".
+func packageDirs(root string, excluded []string) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if dir != root {
+			name := info.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return err
+			}
+			matched, err := ExcludedDir(rel, excluded)
+			if err != nil {
+				return err
+			}
+			if matched {
+				return filepath.SkipDir
+			}
+		}
+		dirs = append(dirs, dir)
+		return nil
+	})
+	return dirs, err
+}
+
+// ExcludedDir reports whether the directory rel, relative to the root of a
+// pattern such as ./..., matches one of patterns as WithExcludedDirs
+// matches them. The directories below it are not reported.
+func ExcludedDir(rel string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(strings.Trim(pattern, "/"), "./")
+		subject := filepath.Base(rel)
+		if strings.Contains(pattern, "/") {
+			subject = filepath.ToSlash(rel)
+		}
+		matched, err := path.Match(pattern, subject)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,316 @@
+package genconstructor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+)
+
+// pkgScope holds the package-level declarations of a package, so that const
+// values naming an identifier of the package can be checked without type
+// information.
+type pkgScope struct {
+	decls map[string]pkgDecl
+	// dotImport reports whether a file of the package dot-imports another
+	// package, whose identifiers cannot be known.
+	dotImport bool
+}
+
+type pkgDecl struct {
+	tok token.Token // token.CONST, token.VAR, token.TYPE or token.FUNC
+	pos token.Pos
+	// typ is the name of the declared type of a constant, if it has one.
+	typ string
+	// nonInterface reports whether a type is declared as something other
+	// than an interface, so that only values of the type are assignable to
+	// it.
+	nonInterface bool
+	// typeExpr is the type a type is declared with.
+	typeExpr ast.Expr
+}
+
+func newPkgScope(pkg *ast.Package) *pkgScope {
+	scope := &pkgScope{decls: make(map[string]pkgDecl)}
+	for _, file := range pkg.Files {
+		for _, spec := range file.Imports {
+			if spec.Name != nil && spec.Name.Name == "." {
+				scope.dotImport = true
+			}
+		}
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					scope.decls[decl.Name.Name] = pkgDecl{tok: token.FUNC, pos: decl.Name.Pos()}
+				}
+			case *ast.GenDecl:
+				scope.addGenDecl(decl)
+			}
+		}
+	}
+	return scope
+}
+
+func (s *pkgScope) addGenDecl(decl *ast.GenDecl) {
+	// constants without type and values repeat the previous ones (iota)
+	var constType string
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			_, isInterface := spec.Type.(*ast.InterfaceType)
+			s.decls[spec.Name.Name] = pkgDecl{
+				tok:          token.TYPE,
+				pos:          spec.Name.Pos(),
+				nonInterface: !isInterface && spec.Assign == 0,
+				typeExpr:     spec.Type,
+			}
+		case *ast.ValueSpec:
+			if decl.Tok == token.CONST {
+				switch {
+				case spec.Type != nil:
+					constType = ""
+					if ident, ok := spec.Type.(*ast.Ident); ok {
+						constType = ident.Name
+					}
+				case len(spec.Values) > 0:
+					constType = ""
+				}
+			}
+			for _, name := range spec.Names {
+				d := pkgDecl{tok: decl.Tok, pos: name.Pos()}
+				if decl.Tok == token.CONST {
+					d.typ = constType
+				}
+				s.decls[name.Name] = d
+			}
+		}
+	}
+}
+
+// declares reports whether name is declared at the package level.
+func (s *pkgScope) declares(name string) bool {
+	_, ok := s.decls[name]
+	return ok
+}
+
+// declaresMethod reports whether pkg declares the method name of the type
+// typeName, with a value or a pointer receiver.
+func declaresMethod(pkg *ast.Package, typeName, name string) bool {
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Recv == nil || len(decl.Recv.List) == 0 || decl.Name.Name != name {
+				continue
+			}
+			recv := decl.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			// receivers of generic types list their type parameters
+			switch x := recv.(type) {
+			case *ast.IndexExpr:
+				recv = x.X
+			case *ast.IndexListExpr:
+				recv = x.X
+			}
+			if ident, ok := recv.(*ast.Ident); ok && ident.Name == typeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkConstValue reports a const value that is an identifier not declared
+// in the package, or a constant of another type than the field type when
+// both types are declared in the package. isLocal reports identifiers that
+// are fields or parameters of the constructor. Other values are left to the
+// compiler.
+func (s *pkgScope) checkConstValue(fieldType ast.Expr, value string, isLocal func(name string) bool) error {
+	expr, err := parser.ParseExpr(value)
+	if err != nil {
+		return nil
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok || isLocal(ident.Name) {
+		return nil
+	}
+	switch ident.Name {
+	case "true", "false", "nil", "iota":
+		return nil
+	}
+
+	decl, ok := s.decls[ident.Name]
+	if !ok {
+		if s.dotImport {
+			return nil
+		}
+		return fmt.Errorf("const value %s is not declared in the package", ident.Name)
+	}
+	if decl.tok == token.TYPE {
+		return fmt.Errorf("const value %s is a type, not a value", ident.Name)
+	}
+
+	typeIdent, ok := fieldType.(*ast.Ident)
+	if !ok || decl.tok != token.CONST || decl.typ == "" || decl.typ == typeIdent.Name {
+		return nil
+	}
+	if typeDecl, ok := s.decls[typeIdent.Name]; ok && typeDecl.tok == token.TYPE && typeDecl.nonInterface {
+		return fmt.Errorf("const value %s is a constant of type %s, not %s", ident.Name, decl.typ, typeIdent.Name)
+	}
+	return nil
+}
+
+// isValue reports whether value reads as a Go expression of the package: it
+// parses, and its identifiers other than package names and selected names
+// are declared in the package or in the universe, or are fields or
+// parameters of the constructor as isLocal reports. Values such as
+// default:"localhost" and default:"30s" of envconfig and creasty/defaults
+// are not.
+func (s *pkgScope) isValue(value string, isLocal func(name string) bool) bool {
+	expr, err := parser.ParseExpr(value)
+	if err != nil {
+		return false
+	}
+	if s.dotImport {
+		return true
+	}
+	skip := make(map[*ast.Ident]bool)
+	declared := true
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			skip[n.Sel] = true
+			if x, ok := n.X.(*ast.Ident); ok {
+				skip[x] = true
+			}
+		case *ast.CompositeLit:
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						skip[key] = true
+					}
+				}
+			}
+		case *ast.FuncLit:
+			// the identifiers declared inside are not known
+			return false
+		case *ast.Ident:
+			if _, ok := s.decls[n.Name]; !ok && !skip[n] && !isLocal(n.Name) && types.Universe.Lookup(n.Name) == nil {
+				declared = false
+			}
+		}
+		return true
+	})
+	return declared
+}
+
+// isNilable reports whether values of typ can be nil, following types
+// declared in the package. Slices are not reported since a nil slice is
+// usable, and types of other packages are not known.
+func (s *pkgScope) isNilable(typ ast.Expr) bool {
+	return s.isNilableDepth(typ, 0)
+}
+
+func (s *pkgScope) isNilableDepth(typ ast.Expr, depth int) bool {
+	if depth > 10 {
+		return false
+	}
+	switch t := typ.(type) {
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return true
+	case *ast.ParenExpr:
+		return s.isNilableDepth(t.X, depth+1)
+	case *ast.Ident:
+		if decl, ok := s.decls[t.Name]; ok {
+			return decl.tok == token.TYPE && s.isNilableDepth(decl.typeExpr, depth+1)
+		}
+		// the predeclared interfaces
+		return t.Name == "error" || t.Name == "any"
+	}
+	return false
+}
+
+// isDependency reports whether typ is a func or interface type, following
+// types declared in the package, but error: the kind of types of the
+// dependencies a factory holds, such as clocks and ID generators.
+func (s *pkgScope) isDependency(typ ast.Expr) bool {
+	for depth := 0; depth <= 10; depth++ {
+		switch t := typ.(type) {
+		case *ast.FuncType, *ast.InterfaceType:
+			return true
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.Ident:
+			decl, ok := s.decls[t.Name]
+			if !ok || decl.tok != token.TYPE {
+				return t.Name == "any"
+			}
+			typ = decl.typeExpr
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// collectionKind returns "slice" or "map" if typ is a slice or map type,
+// following types declared in the package, and "" otherwise.
+func (s *pkgScope) collectionKind(typ ast.Expr) string {
+	for depth := 0; depth <= 10; depth++ {
+		switch t := typ.(type) {
+		case *ast.ArrayType:
+			if t.Len == nil {
+				return "slice"
+			}
+			return ""
+		case *ast.MapType:
+			return "map"
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.Ident:
+			decl, ok := s.decls[t.Name]
+			if !ok || decl.tok != token.TYPE {
+				return ""
+			}
+			typ = decl.typeExpr
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// zeroValue returns the zero value of typ if it is a number or string type,
+// following types declared in the package.
+func (s *pkgScope) zeroValue(typ ast.Expr) (string, bool) {
+	return s.zeroValueDepth(typ, 0)
+}
+
+func (s *pkgScope) zeroValueDepth(typ ast.Expr, depth int) (string, bool) {
+	if depth > 10 {
+		return "", false
+	}
+	switch t := typ.(type) {
+	case *ast.ParenExpr:
+		return s.zeroValueDepth(t.X, depth+1)
+	case *ast.Ident:
+		if decl, ok := s.decls[t.Name]; ok {
+			if decl.tok != token.TYPE {
+				return "", false
+			}
+			return s.zeroValueDepth(decl.typeExpr, depth+1)
+		}
+		switch t.Name {
+		case "string":
+			return `""`, true
+		case "int", "int8", "int16", "int32", "int64",
+			"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+			"float32", "float64", "complex64", "complex128", "byte", "rune":
+			return "0", true
+		}
+	}
+	return "", false
+}
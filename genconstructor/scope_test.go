@@ -0,0 +1,76 @@
+package genconstructor_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRun_enumConstValue(t *testing.T) {
+	decls := `package a
+
+import "time"
+
+type Status int
+
+const (
+	StatusActive Status = iota
+	StatusInactive
+)
+
+type Color string
+
+const ColorRed Color = "red"
+
+const untyped = 1
+
+var defaultStatus = StatusActive
+
+type Stringer interface {
+	String() string
+}
+
+`
+	for _, tt := range []struct {
+		name    string
+		field   string
+		wantErr string
+	}{
+		{name: "typed constant", field: "status Status `required:\"StatusActive\"`"},
+		{name: "constant repeated by iota", field: "status Status `required:\"StatusInactive\"`"},
+		{name: "untyped constant", field: "status Status `required:\"untyped\"`"},
+		{name: "variable", field: "status Status `required:\"defaultStatus\"`"},
+		{name: "interface field", field: "s Stringer `required:\"ColorRed\"`"},
+		{name: "other package", field: "d time.Duration `required:\"time.Second\"`"},
+		{name: "expression", field: "status Status `required:\"StatusActive + 1\"`"},
+		{name: "predeclared", field: "ok bool `required:\"true\"`"},
+		{
+			name:    "typo",
+			field:   "status Status `required:\"StatusActiv\"`",
+			wantErr: "field status: const value StatusActiv is not declared in the package",
+		},
+		{
+			name:    "other enum",
+			field:   "status Status `required:\"ColorRed\"`",
+			wantErr: "const value ColorRed is a constant of type Color, not Status",
+		},
+		{
+			name:    "type",
+			field:   "status Status `required:\"Status\"`",
+			wantErr: "const value Status is a type, not a value",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			src := decls + "//genconstructor\ntype Foo struct {\n\t" + tt.field + "\n}\n\nvar _ = time.Second\n"
+			_, err := generate(t, src)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package genconstructor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+)
+
+// deferSiblingRefs makes const values and derived expressions referring to
+// other fields of the struct select them from the variable name the struct
+// is built into. A composite literal cannot refer to its own fields, so such
+// const values are turned into derived ones, and derived fields are ordered
+// after the fields they refer to.
+// Identifiers which are also parameter names keep referring to the
+// parameters, and the package names of selectors on imports of the file,
+// which maps the names to their paths, keep referring to the packages.
+func deferSiblingRefs(fields []FieldInfo, name string, imports map[string]string) error {
+	siblings := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if f.Kind != KindFlattened {
+			siblings[f.Name] = true
+		}
+	}
+	params := make(map[string]bool, len(fields))
+	for _, f := range paramFields(fields) {
+		params[f.ParamName] = true
+	}
+	isSibling := func(ident string) bool {
+		return siblings[ident] && !params[ident]
+	}
+
+	refs := make(map[string][]string, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		expr := f.Derived
+		if expr == "" {
+			expr = f.ConstValue
+		}
+		if f.Kind == KindFlattened || expr == "" {
+			continue
+		}
+		rewritten, referenced := rewriteSiblingRefs(expr, name, isSibling, imports)
+		if len(referenced) == 0 {
+			continue
+		}
+		f.Kind = KindDerived
+		f.ConstValue = ""
+		f.Derived = rewritten
+		refs[f.Name] = referenced
+	}
+	return orderDerived(fields, refs)
+}
+
+// rewriteSiblingRefs prefixes the identifiers in expr for which isSibling
+// reports true with name, returning the rewritten expression and the
+// referenced identifiers. The package names of selectors on imports are not
+// identifiers of fields. Unparsable expressions are returned as they are.
+func rewriteSiblingRefs(expr string, name string, isSibling func(ident string) bool, imports map[string]string) (string, []string) {
+	fset := token.NewFileSet()
+	node, err := parser.ParseExprFrom(fset, "", expr, 0)
+	if err != nil {
+		return expr, nil
+	}
+
+	skip := make(map[*ast.Ident]bool)
+	var offsets []int
+	var referenced []string
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			skip[n.Sel] = true
+			if x, ok := n.X.(*ast.Ident); ok && imports[x.Name] != "" {
+				skip[x] = true
+			}
+		case *ast.CompositeLit:
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						skip[key] = true
+					}
+				}
+			}
+		case *ast.Ident:
+			if !skip[n] && isSibling(n.Name) {
+				offsets = append(offsets, fset.Position(n.Pos()).Offset)
+				referenced = append(referenced, n.Name)
+			}
+		}
+		return true
+	})
+
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	for _, offset := range offsets {
+		expr = expr[:offset] + name + "." + expr[offset:]
+	}
+	return expr, referenced
+}
+
+// orderDerived reorders the derived fields among themselves so that each
+// comes after the derived fields it refers to. The other fields are left in
+// place.
+func orderDerived(fields []FieldInfo, refs map[string][]string) error {
+	var slots []int
+	derived := make(map[string]FieldInfo)
+	for i, f := range fields {
+		if f.Derived != "" {
+			slots = append(slots, i)
+			derived[f.Name] = f
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(slots))
+	ordered := make([]FieldInfo, 0, len(slots))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("field %s depends on itself", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, ref := range refs[name] {
+			if _, ok := derived[ref]; ok {
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, derived[name])
+		return nil
+	}
+	for _, i := range slots {
+		if err := visit(fields[i].Name); err != nil {
+			return err
+		}
+	}
+	for j, i := range slots {
+		fields[i] = ordered[j]
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package genconstructor_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRun_siblingRefs(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "const value referring to const field",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	retries int ` + "`required:\"3\"`" + `
+	budget  int ` + "`required:\"retries * 10\"`" + `
+}
+`,
+			want: `func NewFoo() Foo {
+	foo := Foo{
+		retries: 3,
+	}
+	foo.budget = foo.retries * 10
+	return foo
+}
+`,
+		},
+		{
+			name: "parameters keep referring to parameters",
+			src: `package a
+
+import "time"
+
+//genconstructor -p
+type Foo struct {
+	timeout  time.Duration ` + "`required:\"\"`" + `
+	Interval time.Duration ` + "`required:\"\"`" + `
+	deadline time.Duration ` + "`required:\"timeout + Interval\"`" + `
+}
+`,
+			want: `func NewFoo(
+	timeout time.Duration,
+	interval time.Duration,
+) *Foo {
+	foo := &Foo{
+		timeout:  timeout,
+		Interval: interval,
+	}
+	foo.deadline = timeout + foo.Interval
+	return foo
+}
+`,
+		},
+		{
+			name: "ordered by dependency",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	a int ` + "`required:\"b + 1\"`" + `
+	b int ` + "`required:\"c + 1\"`" + `
+	c int ` + "`required:\"1\"`" + `
+}
+`,
+			want: `func NewFoo() Foo {
+	foo := Foo{
+		c: 1,
+	}
+	foo.b = foo.c + 1
+	foo.a = foo.b + 1
+	return foo
+}
+`,
+		},
+		{
+			name: "selectors and keys are not fields",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	c   int    ` + "`required:\"1\"`" + `
+	opt Option ` + "`required:\"Option{c: c, d: x.c}\"`" + `
+}
+`,
+			want: `	foo.opt = Option{c: foo.c, d: x.c}
+`,
+		},
+		{
+			name: "package named like a field",
+			src: `package a
+
+import "time"
+
+//genconstructor
+type Foo struct {
+	time    time.Time ` + "`required:\"time.Now()\"`" + `
+	Expires time.Time ` + "`required:\"time.Now().Add(time.Hour)\"`" + `
+}
+`,
+			want: `func NewFoo() Foo {
+	return Foo{
+		time:    time.Now(),
+		Expires: time.Now().Add(time.Hour),
+	}
+}
+`,
+		},
+		{
+			name: "cycle",
+			src: `package a
+
+//genconstructor
+type Foo struct {
+	a int ` + "`required:\"b\"`" + `
+	b int ` + "`required:\"a\"`" + `
+}
+`,
+			wantErr: "depends on itself",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generate(t, tt.src)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
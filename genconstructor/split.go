@@ -0,0 +1,106 @@
+package genconstructor
+
+import (
+	"bytes"
+	"go/ast"
+	"go/build/constraint"
+	"io"
+
+	"github.com/GuiltyMorishita/go-genutil/genutil"
+)
+
+// WithConstraintFiles makes Run write the constructors of the structs of
+// files with build constraints of their own, e.g. foo_linux.go and
+// foo_windows.go declaring Foo per platform, into the writer
+// newWriter(pkg, filename) returns for each such file, guarded by its
+// constraints, instead of merging them into the generated file of the
+// package. It is only done when the marked structs of a package do not all
+// have the same constraints.
+func WithConstraintFiles(newWriter func(pkg *ast.Package, filename string) io.Writer) Option {
+	return func(o *option) {
+		o.newConstraintWriter = newWriter
+	}
+}
+
+// WithStaleConstraintFiles makes Run call remove for each package generated
+// for as a whole, i.e. without WithFiles and WithStructs, with the source
+// files whose constructors were written apart by WithConstraintFiles, none
+// if they were not, so that the files written apart for other source files
+// by an earlier run can be removed. An error of remove is returned by Run.
+func WithStaleConstraintFiles(remove func(pkg *ast.Package, written []string) error) Option {
+	return func(o *option) {
+		o.removeStaleConstraintFiles = remove
+	}
+}
+
+// markedSpec is a struct marked for generation.
+type markedSpec struct {
+	spec   *ast.TypeSpec
+	marker markerOptions
+	// filename is the file declaring spec and constraint its build
+	// constraint, if any.
+	filename   string
+	constraint constraint.Expr
+}
+
+// sourceConstraint returns the build constraint of file named filename,
+// given by its constraint lines and by its name, or nil.
+func sourceConstraint(file *ast.File, filename string) constraint.Expr {
+	return andConstraints([]constraint.Expr{fileConstraint(file), fileNameConstraint(filename)})
+}
+
+// constrainedFiles returns the files of specs with build constraints, if
+// specs do not all have the same constraints.
+func constrainedFiles(specs []markedSpec) []string {
+	seen := make(map[string]bool)
+	for _, s := range specs {
+		seen[constraintString(s.constraint)] = true
+	}
+	if len(seen) < 2 {
+		return nil
+	}
+	var files []string
+	added := make(map[string]bool)
+	for _, s := range specs {
+		if s.constraint != nil && !added[s.filename] {
+			added[s.filename] = true
+			files = append(files, s.filename)
+		}
+	}
+	return files
+}
+
+func constraintString(x constraint.Expr) string {
+	if x == nil {
+		return ""
+	}
+	return x.String()
+}
+
+// output is a generated file being written: the constructors of the
+// structs of the file named filename, or of the package if it is empty.
+type output struct {
+	filename       string
+	body           *bytes.Buffer
+	importPackages map[string]string
+	collector      *fieldCollector
+	constraints    []constraint.Expr
+	// declared are the structs generated for, by name, so that a struct
+	// declared again is reported.
+	declared map[string]*ast.TypeSpec
+}
+
+func newOutput(walker genutil.AstPkgWalker, filename string, opt option, qualifier string, buildTag constraint.Expr) *output {
+	importPackages := make(map[string]string, 10)
+	collector := newFieldCollector(walker, importPackages, opt.tagKey)
+	collector.qualifier = qualifier
+	collector.initialisms = opt.initialisms
+	return &output{
+		filename:       filename,
+		body:           new(bytes.Buffer),
+		importPackages: importPackages,
+		collector:      collector,
+		constraints:    []constraint.Expr{buildTag},
+		declared:       make(map[string]*ast.TypeSpec),
+	}
+}
@@ -0,0 +1,127 @@
+package genconstructor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+)
+
+// WithSubpackage generates the constructors of each package for a package
+// named name importing it, e.g. "ctor" for
+//
+//	func NewFoo(key string) a.Foo
+//
+// Types, constants and functions of the package are qualified, and so must
+// be exported, as must the fields set by the constructors. Methods such as
+// Validate and getters cannot be declared there. The parent package cannot
+// re-export the constructors, which would be an import cycle.
+func WithSubpackage(name string) Option {
+	return func(o *option) {
+		o.subpkg = name
+	}
+}
+
+// qualify returns expr, an expression printed from the package, qualified
+// with c.qualifier if it is set: identifiers declared in the package become
+// selectors of it. They must be exported.
+func (c *fieldCollector) qualify(expr string) (string, error) {
+	if c.qualifier == "" || expr == "" {
+		return expr, nil
+	}
+	x, err := parser.ParseExpr(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid expression %q: %v", expr, err)
+	}
+	// names which are not references: selected names, struct literal
+	// keys, and names of fields and parameters
+	skip := make(map[*ast.Ident]bool)
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			skip[n.Sel] = true
+		case *ast.KeyValueExpr:
+			if key, ok := n.Key.(*ast.Ident); ok {
+				skip[key] = true
+			}
+		case *ast.Field:
+			for _, name := range n.Names {
+				skip[name] = true
+			}
+		case *ast.Ident:
+			if _, ok := c.scope.decls[n.Name]; !ok || skip[n] {
+				return true
+			}
+			if !ast.IsExported(n.Name) {
+				err = fmt.Errorf("%s is not exported and cannot be used from another package", n.Name)
+				return false
+			}
+			n.Name = c.qualifier + "." + n.Name
+		}
+		return err == nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return printExpr(x)
+}
+
+// checkSubpackage returns an error if the constructor of the struct marked
+// with marker and built from fields cannot be generated for the package
+// pkgName, and qualifies fields otherwise.
+func checkSubpackage(c *fieldCollector, marker markerOptions, fields []FieldInfo, pkgName string) error {
+	switch {
+	case marker.super || marker.extends:
+		return fmt.Errorf("-s and -e cannot be used with a subpackage")
+	case marker.validateMethod:
+		return fmt.Errorf("-validate-method cannot be used with a subpackage")
+	case marker.from != "":
+		return fmt.Errorf("-from cannot be used with a subpackage")
+	case marker.unexported || marker.name != "" && !ast.IsExported(marker.name):
+		return fmt.Errorf("unexported constructors cannot be used with a subpackage")
+	}
+	if err := checkSubpackageFields(fields, pkgName); err != nil {
+		return err
+	}
+	for _, f := range paramFields(fields) {
+		if f.ParamName == c.qualifier {
+			return fmt.Errorf("parameter %s shadows package %s", f.ParamName, c.qualifier)
+		}
+	}
+	return c.qualifyFields(fields)
+}
+
+// checkSubpackageFields returns an error if a field set by the constructor is
+// unexported, which cannot be set from another package.
+func checkSubpackageFields(fields []FieldInfo, pkgName string) error {
+	for _, f := range fields {
+		if !ast.IsExported(f.Name) {
+			return fmt.Errorf("field %s is unexported and cannot be set from package %s", f.Name, pkgName)
+		}
+		if f.GenGetter {
+			return fmt.Errorf("field %s: getters cannot be declared in package %s", f.Name, pkgName)
+		}
+		if err := checkSubpackageFields(f.Fields, pkgName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// qualifyFields qualifies the types and expressions of fields, and of the
+// fields they are built from, with c.qualifier.
+func (c *fieldCollector) qualifyFields(fields []FieldInfo) error {
+	for i := range fields {
+		f := &fields[i]
+		for _, s := range []*string{&f.Type, &f.ConstValue, &f.Derived, &f.Transform, &f.NopDefault, &f.Clone} {
+			q, err := c.qualify(*s)
+			if err != nil {
+				return fmt.Errorf("field %s: %v", f.Name, err)
+			}
+			*s = q
+		}
+		if err := c.qualifyFields(f.Fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
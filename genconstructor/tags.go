@@ -0,0 +1,272 @@
+package genconstructor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldKind is how the constructor sets a field.
+type FieldKind int
+
+const (
+	// KindParameter fields are set from a constructor parameter.
+	KindParameter FieldKind = iota
+	// KindConstant fields are set to the expression of their required or
+	// default tag.
+	KindConstant
+	// KindDerived fields are computed once the struct is built.
+	KindDerived
+	// KindFlattened fields are embedded structs built in place from their
+	// own fields (-flatten).
+	KindFlattened
+)
+
+func (k FieldKind) String() string {
+	switch k {
+	case KindParameter:
+		return "parameter"
+	case KindConstant:
+		return "constant"
+	case KindDerived:
+		return "derived"
+	case KindFlattened:
+		return "flattened"
+	}
+	return "unknown"
+}
+
+// fieldTags is the canonical form of the recognized tags of a field.
+type fieldTags struct {
+	kind FieldKind
+	// expr is the expression of a KindConstant or KindDerived field.
+	expr  string
+	super bool
+	// nopDefault is the value substituted for a nil parameter, or "true"
+	// for the nop<Type>{} default.
+	nopDefault string
+	// order is the position of a parameter pinned with the order tag,
+	// starting at 1, or 0.
+	order int
+	// getter is the getter tag of a field set by the constructor, "true"
+	// for getter:"", or empty. It overrides the -g option of the struct when
+	// "true" or "false", and is left to go-genaccessor otherwise.
+	getter string
+	// transform is the function a parameter is passed through.
+	transform string
+	// nonZero makes the zero value of a parameter invalid.
+	nonZero bool
+	// group is the name of the group of parameters which are set together
+	// or not at all.
+	group string
+	// optional reports whether a KindConstant field is set by its default
+	// tag, which an option can override (-options).
+	optional bool
+	// ignore keeps the field out of the constructor even where it would be
+	// set without tags, as embedded structs with -flatten and the fields
+	// of messages with -proto are.
+	ignore bool
+	// copy is "true" when the parameter is copied before it is assigned,
+	// and "false" when it is not even with -copy.
+	copy string
+	// deepCopy is "true" when the value a pointer parameter points to is
+	// cloned before it is assigned, or the function cloning the parameter.
+	deepCopy string
+	// inject is "true" when the parameter is a dependency held by the
+	// factory of the struct, and "false" when it is passed to Create even
+	// if its type is one of a dependency (-factory).
+	inject string
+}
+
+// parseFieldTags normalizes the recognized tags of a field, rejecting
+// combinations with no single meaning. requiredKey is the key of the
+// required tag. isDefault, if not nil, reports whether the value of a
+// default tag is one of the constructor rather than of another package
+// reading the tag. ok is false when the field has none of them and is left
+// alone by the constructor.
+func parseFieldTags(tag reflect.StructTag, requiredKey string, isDefault func(value string) bool) (fieldTags, bool, error) {
+	tags, ok, err := parseKind(tag, requiredKey, isDefault)
+	if err != nil {
+		return fieldTags{}, false, err
+	}
+
+	if nopDefault, hasNopDefault := tag.Lookup("nopdefault"); hasNopDefault && nopDefault != "false" {
+		if !ok || tags.kind != KindParameter {
+			return fieldTags{}, false, errors.New("nopdefault can only be used on parameter fields")
+		}
+		if strings.TrimSpace(nopDefault) == "" {
+			return fieldTags{}, false, errors.New("nopdefault tag needs \"true\" or a value")
+		}
+		tags.nopDefault = nopDefault
+	}
+
+	if order, hasOrder := tag.Lookup("order"); hasOrder {
+		if !ok || tags.kind != KindParameter {
+			return fieldTags{}, false, errors.New("order can only be used on parameter fields")
+		}
+		n, err := strconv.Atoi(order)
+		if err != nil || n == 0 {
+			return fieldTags{}, false, errors.New("order tag needs a position, from 1 or from -1 for the last")
+		}
+		tags.order = n
+	}
+
+	// the getter tag of the other fields is the one of go-genaccessor
+	if getter, hasGetter := tag.Lookup("getter"); hasGetter && ok {
+		if getter == "" {
+			// getter:"" asks for the getter as getter:"true" does
+			getter = "true"
+		}
+		tags.getter = getter
+	}
+
+	if transform, hasTransform := tag.Lookup("transform"); hasTransform {
+		if !ok || tags.kind != KindParameter {
+			return fieldTags{}, false, errors.New("transform can only be used on parameter fields")
+		}
+		if strings.TrimSpace(transform) == "" {
+			return fieldTags{}, false, errors.New("transform tag needs a function")
+		}
+		tags.transform = transform
+	}
+
+	if copied, hasCopy := tag.Lookup("copy"); hasCopy {
+		if !ok || tags.kind != KindParameter {
+			return fieldTags{}, false, errors.New("copy can only be used on parameter fields")
+		}
+		if copied != "true" && copied != "false" {
+			return fieldTags{}, false, errors.New("copy tag needs \"true\" or \"false\"")
+		}
+		tags.copy = copied
+	}
+
+	if deepCopy, hasDeepCopy := tag.Lookup("deepcopy"); hasDeepCopy && deepCopy != "false" {
+		if !ok || tags.kind != KindParameter {
+			return fieldTags{}, false, errors.New("deepcopy can only be used on parameter fields")
+		}
+		if tags.copy == "true" {
+			return fieldTags{}, false, errors.New("deepcopy field cannot be tagged with copy")
+		}
+		if deepCopy == "" {
+			deepCopy = "true"
+		}
+		if deepCopy != "true" && !isFuncName(deepCopy) {
+			return fieldTags{}, false, errors.New("deepcopy tag needs \"true\", \"false\" or a function")
+		}
+		tags.deepCopy = deepCopy
+	}
+
+	if inject, hasInject := tag.Lookup("inject"); hasInject {
+		if !ok || tags.kind != KindParameter {
+			return fieldTags{}, false, errors.New("inject can only be used on parameter fields")
+		}
+		if inject != "true" && inject != "false" {
+			return fieldTags{}, false, errors.New("inject tag needs \"true\" or \"false\"")
+		}
+		tags.inject = inject
+	}
+
+	if nonZero, hasNonZero := tag.Lookup("nonzero"); hasNonZero && nonZero != "false" {
+		if !ok || tags.kind != KindParameter {
+			return fieldTags{}, false, errors.New("nonzero can only be used on parameter fields")
+		}
+		if nonZero != "true" {
+			return fieldTags{}, false, errors.New("nonzero tag needs \"true\" or \"false\"")
+		}
+		tags.nonZero = true
+	}
+
+	if group, hasGroup := tag.Lookup("group"); hasGroup {
+		if !ok || tags.kind != KindParameter {
+			return fieldTags{}, false, errors.New("group can only be used on parameter fields")
+		}
+		// the name is written in the error of Validate
+		if strings.TrimSpace(group) == "" || strings.ContainsAny(group, "\"\\") {
+			return fieldTags{}, false, errors.New("group tag needs a name")
+		}
+		if tags.nonZero {
+			return fieldTags{}, false, errors.New("nonzero field cannot be in a group")
+		}
+		tags.group = group
+	}
+
+	if ignore, hasIgnore := tag.Lookup("ctorignore"); hasIgnore && ignore != "false" {
+		if ignore != "true" {
+			return fieldTags{}, false, errors.New("ctorignore tag needs \"true\" or \"false\"")
+		}
+		if ok {
+			return fieldTags{}, false, fmt.Errorf("ctorignore field cannot be tagged with %s, derived or super", requiredKey)
+		}
+		return fieldTags{ignore: true}, false, nil
+	}
+	// genconstructor:"-" is ctorignore:"true" in the style of json:"-"
+	if skip, hasSkip := tag.Lookup("genconstructor"); hasSkip {
+		if skip != "-" {
+			return fieldTags{}, false, errors.New("genconstructor tag needs \"-\"")
+		}
+		if ok {
+			return fieldTags{}, false, fmt.Errorf("genconstructor:\"-\" field cannot be tagged with %s, derived or super", requiredKey)
+		}
+		return fieldTags{ignore: true}, false, nil
+	}
+	return tags, ok, nil
+}
+
+// parameterTags are the tags only parameter fields take.
+var parameterTags = []string{"order", "nonzero", "transform", "group", "nopdefault", "copy", "deepcopy", "inject"}
+
+// impliedParameter returns tag with requiredKey:"" added if it has a tag
+// only parameter fields take but none deciding the kind of the field or
+// leaving it out, for the fields which are parameters without tags (-all
+// and -proto).
+func impliedParameter(tag reflect.StructTag, requiredKey string) reflect.StructTag {
+	for _, key := range []string{requiredKey, "super", "derived", "default", "ctorignore", "genconstructor"} {
+		if _, ok := tag.Lookup(key); ok {
+			return tag
+		}
+	}
+	for _, key := range parameterTags {
+		if _, ok := tag.Lookup(key); ok {
+			return reflect.StructTag(requiredKey+`:"" `) + tag
+		}
+	}
+	return tag
+}
+
+// parseKind reads the tags deciding the kind of a field.
+func parseKind(tag reflect.StructTag, requiredKey string, isDefault func(value string) bool) (fieldTags, bool, error) {
+	required, hasRequired := tag.Lookup(requiredKey)
+	_, hasSuper := tag.Lookup("super")
+	derived, hasDerived := tag.Lookup("derived")
+	def, hasDefault := tag.Lookup("default")
+	if hasDefault && strings.TrimSpace(def) != "" && isDefault != nil && !isDefault(def) {
+		// e.g. default:"localhost" of envconfig
+		hasDefault = false
+	}
+
+	switch {
+	case hasDefault:
+		if hasRequired || hasSuper || hasDerived {
+			return fieldTags{}, false, fmt.Errorf("default field cannot be tagged with %s, derived or super", requiredKey)
+		}
+		if strings.TrimSpace(def) == "" {
+			return fieldTags{}, false, errors.New("default tag needs an expression")
+		}
+		return fieldTags{kind: KindConstant, expr: def, optional: true}, true, nil
+	case hasDerived:
+		if hasRequired || hasSuper {
+			return fieldTags{}, false, fmt.Errorf("derived field cannot be tagged with %s or super", requiredKey)
+		}
+		if strings.TrimSpace(derived) == "" {
+			return fieldTags{}, false, errors.New("derived tag needs an expression")
+		}
+		return fieldTags{kind: KindDerived, expr: derived}, true, nil
+	case hasRequired && required != "":
+		return fieldTags{kind: KindConstant, expr: required, super: hasSuper}, true, nil
+	case hasRequired || hasSuper:
+		return fieldTags{kind: KindParameter, super: hasSuper}, true, nil
+	}
+	return fieldTags{}, false, nil
+}
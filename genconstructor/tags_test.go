@@ -0,0 +1,87 @@
+package genconstructor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldTags(t *testing.T) {
+	for _, tt := range []struct {
+		tag     reflect.StructTag
+		want    fieldTags
+		wantOK  bool
+		wantErr string
+	}{
+		{tag: `json:"id"`},
+		{tag: `required:""`, want: fieldTags{kind: KindParameter}, wantOK: true},
+		{tag: `required:"time.Now()"`, want: fieldTags{kind: KindConstant, expr: "time.Now()"}, wantOK: true},
+		{tag: `super:""`, want: fieldTags{kind: KindParameter, super: true}, wantOK: true},
+		{tag: `required:"" super:""`, want: fieldTags{kind: KindParameter, super: true}, wantOK: true},
+		{tag: `derived:"f(x)"`, want: fieldTags{kind: KindDerived, expr: "f(x)"}, wantOK: true},
+		{tag: `derived:" "`, wantErr: "derived tag needs an expression"},
+		{tag: `required:"" derived:"f(x)"`, wantErr: "derived field cannot be tagged with required or super"},
+		{tag: `super:"" derived:"f(x)"`, wantErr: "derived field cannot be tagged with required or super"},
+		{tag: `default:"time.Second"`, want: fieldTags{kind: KindConstant, expr: "time.Second", optional: true}, wantOK: true},
+		{tag: `default:""`, wantErr: "default tag needs an expression"},
+		{tag: `required:"" default:"1"`, wantErr: "default field cannot be tagged with required, derived or super"},
+		{tag: `required:"" order:"2"`, want: fieldTags{kind: KindParameter, order: 2}, wantOK: true},
+		{tag: `required:"" order:"-1"`, want: fieldTags{kind: KindParameter, order: -1}, wantOK: true},
+		{tag: `required:"" order:"0"`, wantErr: "order tag needs a position, from 1 or from -1 for the last"},
+		{tag: `required:"" order:"first"`, wantErr: "order tag needs a position, from 1 or from -1 for the last"},
+		{tag: `required:"1" order:"1"`, wantErr: "order can only be used on parameter fields"},
+		{tag: `order:"1"`, wantErr: "order can only be used on parameter fields"},
+		{tag: `required:"" getter:"true"`, want: fieldTags{kind: KindParameter, getter: "true"}, wantOK: true},
+		{tag: `derived:"f(x)" getter:"false"`, want: fieldTags{kind: KindDerived, expr: "f(x)", getter: "false"}, wantOK: true},
+		{tag: `required:"" getter:""`, want: fieldTags{kind: KindParameter, getter: "true"}, wantOK: true},
+		{tag: `required:"" getter:"GetName"`, want: fieldTags{kind: KindParameter, getter: "GetName"}, wantOK: true},
+		{tag: `getter:"true"`},
+		{tag: `json:"name" getter:""`},
+		{tag: `required:"" transform:"strings.TrimSpace"`, want: fieldTags{kind: KindParameter, transform: "strings.TrimSpace"}, wantOK: true},
+		{tag: `required:"x" transform:"strings.TrimSpace"`, wantErr: "transform can only be used on parameter fields"},
+		{tag: `required:"" transform:" "`, wantErr: "transform tag needs a function"},
+		{tag: `required:"" nonzero:"true"`, want: fieldTags{kind: KindParameter, nonZero: true}, wantOK: true},
+		{tag: `required:"" nonzero:"false"`, want: fieldTags{kind: KindParameter}, wantOK: true},
+		{tag: `required:"0" nonzero:"true"`, wantErr: "nonzero can only be used on parameter fields"},
+		{tag: `required:"" group:"creds"`, want: fieldTags{kind: KindParameter, group: "creds"}, wantOK: true},
+		{tag: `required:"x" group:"creds"`, wantErr: "group can only be used on parameter fields"},
+		{tag: `required:"" group:" "`, wantErr: "group tag needs a name"},
+		{tag: `required:"" nonzero:"true" group:"creds"`, wantErr: "nonzero field cannot be in a group"},
+		{tag: `ctorignore:"true"`, want: fieldTags{ignore: true}},
+		{tag: `ctorignore:"false"`},
+		{tag: `ctorignore:"yes"`, wantErr: "ctorignore tag needs \"true\" or \"false\""},
+		{tag: `required:"" ctorignore:"true"`, wantErr: "ctorignore field cannot be tagged with required, derived or super"},
+		{tag: `required:"" copy:"true"`, want: fieldTags{kind: KindParameter, copy: "true"}, wantOK: true},
+		{tag: `required:"" copy:"false"`, want: fieldTags{kind: KindParameter, copy: "false"}, wantOK: true},
+		{tag: `required:"" copy:"yes"`, wantErr: "copy tag needs \"true\" or \"false\""},
+		{tag: `required:"nil" copy:"true"`, wantErr: "copy can only be used on parameter fields"},
+		{tag: `required:"" deepcopy:""`, want: fieldTags{kind: KindParameter, deepCopy: "true"}, wantOK: true},
+		{tag: `required:"" deepcopy:"cloneFoo"`, want: fieldTags{kind: KindParameter, deepCopy: "cloneFoo"}, wantOK: true},
+		{tag: `required:"" deepcopy:"false"`, want: fieldTags{kind: KindParameter}, wantOK: true},
+		{tag: `required:"" deepcopy:"a b"`, wantErr: "deepcopy tag needs \"true\", \"false\" or a function"},
+		{tag: `required:"" copy:"true" deepcopy:""`, wantErr: "deepcopy field cannot be tagged with copy"},
+		{tag: `required:"x" deepcopy:""`, wantErr: "deepcopy can only be used on parameter fields"},
+		{tag: `required:"" inject:"true"`, want: fieldTags{kind: KindParameter, inject: "true"}, wantOK: true},
+		{tag: `required:"" inject:"false"`, want: fieldTags{kind: KindParameter, inject: "false"}, wantOK: true},
+		{tag: `required:"" inject:""`, wantErr: "inject tag needs \"true\" or \"false\""},
+		{tag: `required:"x" inject:"true"`, wantErr: "inject can only be used on parameter fields"},
+		{tag: `genconstructor:"-"`, want: fieldTags{ignore: true}},
+		{tag: `json:"id" genconstructor:"-"`, want: fieldTags{ignore: true}},
+		{tag: `genconstructor:"skip"`, wantErr: "genconstructor tag needs \"-\""},
+		{tag: `required:"" genconstructor:"-"`, wantErr: "genconstructor:\"-\" field cannot be tagged with required, derived or super"},
+	} {
+		got, ok, err := parseFieldTags(tt.tag, "required", nil)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: error = %v, want %q", tt.tag, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.tag, err)
+			continue
+		}
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: got %+v, %v, want %+v, %v", tt.tag, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package genconstructor
+
+import (
+	"go/ast"
+	"os"
+	"path/filepath"
+)
+
+// WithSkipIfUpToDate makes Run leave a package alone if the file at
+// outputPath(pkg), its generated file, was modified after every source file
+// of the package. It compares modification times only, so it is faster than
+// regenerating but can be fooled by clock skew or by tools setting them,
+// such as some checkouts and archive extractions.
+func WithSkipIfUpToDate(outputPath func(pkg *ast.Package) string) Option {
+	return func(o *option) {
+		o.outputPath = outputPath
+	}
+}
+
+// upToDate reports whether the file at output exists and was modified after
+// the source files of pkg other than itself.
+func upToDate(pkg *ast.Package, output string) (bool, error) {
+	outInfo, err := os.Stat(output)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return false, err
+	}
+	for filename := range pkg.Files {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return false, err
+		}
+		if abs == output {
+			continue
+		}
+		finfo, err := os.Stat(filename)
+		if err != nil {
+			return false, err
+		}
+		if !finfo.ModTime().Before(outInfo.ModTime()) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
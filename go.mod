@@ -1,9 +1,10 @@
 module github.com/GuiltyMorishita/go-genconstructor
 
-go 1.12
+go 1.18
+
+require github.com/GuiltyMorishita/go-genutil v0.0.0-20190815004345-5e593622e6dd
 
 require (
 	github.com/GuiltyMorishita/go-genaccessor v0.0.0-20190815004557-43035fd70571 // indirect
-	github.com/GuiltyMorishita/go-genutil v0.0.0-20190815004345-5e593622e6dd // indirect
 	github.com/stretchr/objx v0.2.0 // indirect
 )
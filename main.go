@@ -1,50 +1,707 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"go/ast"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/GuiltyMorishita/go-genconstructor/genconstructor"
 )
 
+// Exit codes of the command.
+const (
+	exitOK    = 0
+	exitError = 1
+	// exitOutOfDate is returned by -check when generated files are out of
+	// date.
+	exitOutOfDate = 2
+)
+
 func main() {
-	if err := Main(os.Args); err != nil {
+	os.Exit(exitCode(Main(os.Args)))
+}
+
+// exitCode reports err, if any, and returns the exit code for it.
+func exitCode(err error) int {
+	var usageErr usageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		// already reported with the usage by the flag set
+		return exitError
+	}
+	var outOfDate outOfDateError
+	if errors.As(err, &outOfDate) {
 		log.Print(err)
-		fmt.Printf(`
-Usage: %s [targetDir]
-`, os.Args[0])
+		return exitOutOfDate
 	}
+	log.Print(err)
+	return exitError
 }
 
+// usageError is an error in the command line arguments.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+
+func (e usageError) Unwrap() error { return e.err }
+
 func Main(args []string) error {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [-force] [-prefix prefix] [-suffix suffix] [-output name.go] [-no-header] [-tag-key key] [-marker comment] [-hook name [-hook-type type]] [-single-line-params n] [-group-params] [-di fx|wire|do] [-wire] [-fx] [-do] [-file name.go] [-structs regexp] [-subpkg name] [-assert-fields] [-test-stubs] [-usage-guards] [-stamp] [-skip-up-to-date] [-manifest dir] [-template file] [-jobs n] [-cache file] [-check | -diff | -stdout | -dry-run | -watch] [-serve] [targetDir | dir/...]\n", args[0])
+		flags.PrintDefaults()
+	}
+	force := flags.Bool("force", false, "make read-only generated files writable before overwriting them")
+	prefix := flags.String("prefix", "", "prefix of the generated file names, e.g. zz_generated. to sort them last")
+	suffixFlag := flags.String("suffix", "", "suffix of the generated file names (default \"_constructor_gen.go\")")
+	output := flags.String("output", "", "name of the generated file of each package, e.g. zz_generated.constructors.go, instead of <prefix><package><suffix>")
+	noHeader := flags.Bool("no-header", false, "omit the generated-code comment")
+	tagKey := flags.String("tag-key", "", "key of the tag marking constructor fields instead of required, e.g. ctor")
+	marker := flags.String("marker", "", "comment marking the structs generated for instead of //genconstructor, e.g. //myco:constructor")
+	hook := flags.String("hook", "", "name of a package-level function variable each constructor calls with the type name, e.g. onConstruct")
+	hookType := flags.String("hook-type", "", "type the hook variable is declared as (default \"func(name string)\")")
+	singleLineParams := flags.Int("single-line-params", 0, "put the parameters of constructors taking at most n of them on a single line")
+	groupParams := flags.Bool("group-params", false, "declare consecutive parameters of the same type together, e.g. id, name string")
+	di := flags.String("di", "", "also register the constructors of each package with a DI framework: fx (var Module), wire (var ProviderSet) or do (func Register)")
+	wire := flags.Bool("wire", false, "the same as -di wire: also declare var ProviderSet = wire.NewSet(...) listing the constructors of each package")
+	fx := flags.Bool("fx", false, "the same as -di fx: also declare var Module = fx.Options(fx.Provide(...), ...) listing the constructors of each package")
+	do := flags.Bool("do", false, "the same as -di do: also declare a ProvideFoo(*do.Injector) provider per constructor and func Register registering them")
+	file := flags.String("file", "", "generate only for the structs of this file of the package, e.g. $GOFILE (default: every file)")
+	structs := flags.String("structs", "", "generate only for the marked structs whose whole names this regular expression matches, e.g. 'Order(Line)?'")
+	subpkg := flags.String("subpkg", "", "generate the constructors into the subpackage of this name, e.g. ctor for ./ctor/ctor_constructor_gen.go")
+	assertFields := flags.Bool("assert-fields", false, "also write a test asserting the field counts of the structs, failing once a field is added until the constructor is regenerated")
+	testStubs := flags.Bool("test-stubs", false, "also write a test calling each constructor with zero values, failing to compile once its parameters change until it is regenerated")
+	usageGuards := flags.Bool("usage-guards", false, "also declare var _ = newFoo for each unexported constructor, so that linters do not report the ones only used by tests as unused")
+	stamp := flags.Bool("stamp", false, "name the module and version of the generator in the generated-code comment")
+	skipUpToDate := flags.Bool("skip-up-to-date", false, "leave packages whose generated file was modified after their source files")
+	manifestDir := flags.String("manifest", "", "also write constructors_manifest.go into the package in this directory, registering the generated constructors by type")
+	tmplFile := flags.String("template", "", "text/template file replacing the built-in constructor template")
+	jobs := flags.Int("jobs", runtime.GOMAXPROCS(0), "number of packages generated for at once")
+	cacheFile := flags.String("cache", "", "file recording a hash of the files of each package, e.g. .genconstructor.cache, to skip the packages unchanged since")
+	check := flags.Bool("check", false, "write nothing, and fail listing the generated files which are missing or differ from the ones generated")
+	diff := flags.Bool("diff", false, "write nothing, and print a unified diff from the generated files to the ones generated, failing if they differ")
+	stdout := flags.Bool("stdout", false, "write nothing, and print the generated files to stdout instead")
+	dryRun := flags.Bool("dry-run", false, "write nothing, and print the paths of the files which would be written or removed")
+	watchMode := flags.Bool("watch", false, "keep running, and regenerate the packages whose Go files change")
+	serveMode := flags.Bool("serve", false, "read newline-delimited JSON requests from stdin and write the generated files as JSON responses to stdout")
+	if err := flags.Parse(args[1:]); err != nil {
+		return usageError{err: err}
+	}
+
+	if *serveMode {
+		return serve(os.Stdin, os.Stdout, *prefix)
+	}
+	// buffered keeps the generated files in memory instead of writing them
+	buffered := false
+	for _, b := range []bool{*check, *diff, *stdout, *dryRun} {
+		if b && buffered {
+			return errors.New("-check, -diff, -stdout and -dry-run cannot be used together")
+		}
+		buffered = buffered || b
+	}
+	if *watchMode && buffered {
+		return errors.New("-watch cannot be used with -check, -diff, -stdout or -dry-run")
+	}
+	if *cacheFile != "" && buffered {
+		// the files compared or printed must be generated for every package
+		return errors.New("-cache cannot be used with -check, -diff, -stdout or -dry-run")
+	}
+
+	// -wire, -fx and -do stand for -di wire, -di fx and -di do
+	diFlag := "-di " + *di
+	for _, f := range []struct {
+		set bool
+		di  string
+	}{{*wire, genconstructor.DIWire}, {*fx, genconstructor.DIFx}, {*do, genconstructor.DIDo}} {
+		if !f.set {
+			continue
+		}
+		if *di != "" && *di != f.di {
+			return fmt.Errorf("-%s cannot be used with %s", f.di, diFlag)
+		}
+		*di, diFlag = f.di, "-"+f.di
+	}
+
 	targetDir := "."
-	if len(args) > 1 {
-		targetDir = args[1]
+	if flags.NArg() > 0 {
+		targetDir = flags.Arg(0)
 	}
 
-	if err := genconstructor.Run(
-		targetDir,
-		func(pkg *ast.Package) io.Writer {
-			dstFileName := fmt.Sprintf("%s_constructor_gen.go", pkg.Name)
-			dstFilePath := filepath.Join(filepath.FromSlash(targetDir), dstFileName)
-			f, err := os.Create(dstFilePath)
-			if err != nil {
-				panic(err)
-			}
-			return f
-		},
+	// the configuration file of the module takes the place of the flags
+	// not given
+	cfg, cfgPath, err := loadConfig(patternDir(targetDir))
+	if err != nil {
+		return err
+	}
+	suffix := "_constructor_gen.go"
+	switch {
+	case *suffixFlag != "":
+		if !validGoFileSuffix(*suffixFlag) {
+			return fmt.Errorf("-suffix %q must end with .go and not with _test.go", *suffixFlag)
+		}
+		suffix = *suffixFlag
+	case cfg.Suffix != "":
+		if !validGoFileSuffix(cfg.Suffix) {
+			return fmt.Errorf("%s: suffix %q must end with .go and not with _test.go", cfgPath, cfg.Suffix)
+		}
+		suffix = cfg.Suffix
+	}
+	if *output != "" && (filepath.Base(*output) != *output || !validGoFileSuffix(*output)) {
+		return fmt.Errorf("-output %q must be a file name ending with .go and not with _test.go", *output)
+	}
+	if *tmplFile == "" {
+		*tmplFile = cfg.Template
+	}
+
+	// outputPath returns the path of the generated file of pkg.
+	outputPath := func(pkg *ast.Package) string {
+		dstDir, pkgName := pkgDir(pkg, targetDir), pkg.Name
+		if *subpkg != "" {
+			dstDir, pkgName = filepath.Join(dstDir, *subpkg), *subpkg
+		}
+		if *output != "" {
+			return filepath.Join(dstDir, *output)
+		}
+		return filepath.Join(dstDir, *prefix+pkgName+suffix)
+	}
+	// testPath returns the path of the test of the field assertions and
+	// of the constructor calls of pkg.
+	testPath := func(pkg *ast.Package) string {
+		return filepath.Join(pkgDir(pkg, targetDir), *prefix+pkg.Name+strings.TrimSuffix(suffix, ".go")+"_test.go")
+	}
+
+	// open returns the writer of the generated file at path, creating its
+	// directory, or a buffer compared to the file with -check or printed
+	// with -stdout and -dry-run. It is called for several packages at once
+	// with -jobs.
+	generated := make(map[string]*bytes.Buffer)
+	var mu sync.Mutex
+	open := func(path string) io.Writer {
+		if buffered {
+			b := new(bytes.Buffer)
+			mu.Lock()
+			generated[path] = b
+			mu.Unlock()
+			return b
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return errWriter{err: err}
+		}
+		f, err := createFile(path, *force)
+		if err != nil {
+			return errWriter{err: err}
+		}
+		return f
+	}
+
+	// remove removes the generated file at path left from a previous run,
+	// or records that it must not exist when the files are buffered
+	remove := func(path string) error {
+		if buffered {
+			mu.Lock()
+			generated[path] = nil
+			mu.Unlock()
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	opts := []genconstructor.Option{
 		genconstructor.WithFileFilter(
 			func(finfo os.FileInfo) bool {
 				return !strings.HasSuffix(finfo.Name(), "_test.go")
 			},
 		),
-	); err != nil {
+		genconstructor.WithStaleOutput(func(pkg *ast.Package) error {
+			if err := remove(outputPath(pkg)); err != nil {
+				return err
+			}
+			if *assertFields || *testStubs {
+				return remove(testPath(pkg))
+			}
+			return nil
+		}),
+	}
+	if suffix != "_constructor_gen.go" {
+		opts = append(opts, genconstructor.WithGeneratedSuffix(suffix))
+	}
+	if *output != "" {
+		opts = append(opts, genconstructor.WithGeneratedFileName(*output))
+	}
+	if len(cfg.Exclude) > 0 {
+		opts = append(opts, genconstructor.WithExcludedDirs(cfg.Exclude...))
+	}
+	if len(cfg.Initialisms) > 0 {
+		opts = append(opts, genconstructor.WithInitialisms(cfg.Initialisms...))
+	}
+	if cfg.Marker != "" {
+		opts = append(opts, genconstructor.WithDefaultMarker(cfg.Marker))
+	}
+	if *jobs > 1 {
+		opts = append(opts, genconstructor.WithJobs(*jobs))
+	}
+	if *noHeader {
+		opts = append(opts, genconstructor.WithoutHeader())
+	}
+	if *stamp {
+		opts = append(opts, genconstructor.WithGeneratorName(stampedGeneratorName("go-genconstructor")))
+	}
+	if *tagKey != "" {
+		opts = append(opts, genconstructor.WithTagKey(*tagKey))
+	}
+	if *singleLineParams > 0 {
+		opts = append(opts, genconstructor.WithSingleLineParams(*singleLineParams))
+	}
+	if *groupParams {
+		opts = append(opts, genconstructor.WithGroupedParams())
+	}
+	if *file != "" {
+		opts = append(opts, genconstructor.WithFiles(*file))
+	}
+	if *structs != "" {
+		re, err := regexp.Compile("^(?:" + *structs + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid -structs: %v", err)
+		}
+		opts = append(opts, genconstructor.WithStructs(re))
+	}
+	if *di != "" {
+		opts = append(opts, genconstructor.WithDI(*di))
+	}
+	if *marker != "" {
+		opts = append(opts, genconstructor.WithMarker(*marker))
+	}
+	if *hook != "" {
+		opts = append(opts, genconstructor.WithHook(*hook, *hookType))
+	}
+	if *subpkg != "" {
+		opts = append(opts, genconstructor.WithSubpackage(*subpkg))
+	}
+	if *tmplFile != "" {
+		opts = append(opts, genconstructor.WithTemplateFile(*tmplFile))
+	}
+	if *skipUpToDate {
+		opts = append(opts, genconstructor.WithSkipIfUpToDate(outputPath))
+	}
+	if *manifestDir != "" {
+		pkgPath, err := dirImportPath(*manifestDir)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, genconstructor.WithManifest(pkgPath, func() io.Writer {
+			return open(filepath.Join(filepath.FromSlash(*manifestDir), "constructors_manifest.go"))
+		}))
+	}
+	// the constructors of files with build constraints of their own, such
+	// as foo_linux.go, go to foo_linux_constructor_gen.go next to the
+	// generated file of the package
+	constraintPath := func(pkg *ast.Package, filename string) string {
+		dstFileName := *prefix + strings.TrimSuffix(filepath.Base(filename), ".go") + suffix
+		return filepath.Join(filepath.Dir(outputPath(pkg)), dstFileName)
+	}
+	opts = append(opts, genconstructor.WithConstraintFiles(func(pkg *ast.Package, filename string) io.Writer {
+		return open(constraintPath(pkg, filename))
+	}))
+	// and those written by an earlier run for other files are removed
+	opts = append(opts, genconstructor.WithStaleConstraintFiles(func(pkg *ast.Package, written []string) error {
+		keep := map[string]bool{outputPath(pkg): true}
+		for _, filename := range written {
+			keep[constraintPath(pkg, filename)] = true
+		}
+		var sources []string
+		for filename := range pkg.Files {
+			sources = append(sources, constraintPath(pkg, filename))
+		}
+		paths, err := staleConstraintFiles(filepath.Join(filepath.Dir(outputPath(pkg)), *prefix+"*"+suffix), keep, sources)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if err := remove(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	// both write into the same test
+	openTest := func(pkg *ast.Package) io.Writer {
+		return open(testPath(pkg))
+	}
+	if *assertFields {
+		opts = append(opts, genconstructor.WithFieldAssertions(openTest))
+	}
+	if *testStubs {
+		opts = append(opts, genconstructor.WithConstructorTests(openTest))
+	}
+	if *usageGuards {
+		opts = append(opts, genconstructor.WithUsageGuards())
+	}
+
+	var cache *genconstructor.Cache
+	if *cacheFile != "" {
+		fingerprint, err := cacheFingerprint(args[1:], cfg, *tmplFile)
+		if err != nil {
+			return err
+		}
+		if cache, err = genconstructor.OpenCache(*cacheFile, fingerprint); err != nil {
+			return err
+		}
+		opts = append(opts, genconstructor.WithCache(cache))
+	} else if *watchMode && *manifestDir == "" {
+		// only the packages changed since the previous run are generated
+		// for again
+		if cache, err = genconstructor.OpenCache("", ""); err != nil {
+			return err
+		}
+		opts = append(opts, genconstructor.WithCache(cache))
+	}
+
+	generate := func() error {
+		if err := genconstructor.Run(
+			targetDir,
+			func(pkg *ast.Package) io.Writer {
+				return open(outputPath(pkg))
+			},
+			opts...,
+		); err != nil {
+			return err
+		}
+		if cache != nil {
+			return cache.Save()
+		}
+		return nil
+	}
+	if *watchMode {
+		// the generated files are left out, so that writing them does not
+		// trigger another run
+		watched := func(path string) bool {
+			name := filepath.Base(path)
+			return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") &&
+				!strings.HasSuffix(name, suffix) && name != *output && name != "constructors_manifest.go"
+		}
+		return watch(targetDir, cfg.Exclude, watched, generate)
+	}
+	if err := generate(); err != nil {
 		return err
 	}
+	switch {
+	case *check:
+		return checkFiles(generated)
+	case *diff:
+		return diffFiles(os.Stdout, generated)
+	case *stdout:
+		return printFiles(os.Stdout, generated)
+	case *dryRun:
+		return listFiles(os.Stdout, generated)
+	}
+	return nil
+}
+
+// validGoFileSuffix reports whether suffix names Go files other than tests.
+func validGoFileSuffix(suffix string) bool {
+	return strings.HasSuffix(suffix, ".go") && !strings.HasSuffix(suffix, "_test.go")
+}
+
+// patternDir returns the directory of targetDir, which may be a pattern
+// such as ./....
+func patternDir(targetDir string) string {
+	dir := strings.TrimSuffix(strings.TrimSuffix(filepath.ToSlash(targetDir), "..."), "/")
+	if dir == "" {
+		return "."
+	}
+	return filepath.FromSlash(dir)
+}
+
+// pkgDir returns the directory of the files of pkg, which is targetDir
+// unless it is a pattern such as ./... matching the directories below it.
+func pkgDir(pkg *ast.Package, targetDir string) string {
+	for filename := range pkg.Files {
+		return filepath.Dir(filename)
+	}
+	return filepath.FromSlash(targetDir)
+}
+
+// stampedGeneratorName returns name followed by the module and version the
+// command is built from, e.g. "go-genconstructor (module
+// github.com/GuiltyMorishita/go-genconstructor v1.2.0)". The version is left
+// out when it is unknown, and name is returned as is without build info.
+func stampedGeneratorName(name string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Path == "" {
+		return name
+	}
+	module := info.Main.Path
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		module += " " + v
+	}
+	return fmt.Sprintf("%s (module %s)", name, module)
+}
+
+// cacheFingerprint returns what the generated files depend on besides the
+// files of the packages: the arguments, the configuration, the template and
+// the version of the command.
+func cacheFingerprint(args []string, cfg config, tmplFile string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%q\n%#v\n", args, cfg)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&b, "%s %s %s\n", info.GoVersion, info.Main.Path, info.Main.Version)
+		for _, s := range info.Settings {
+			if strings.HasPrefix(s.Key, "vcs.") {
+				fmt.Fprintf(&b, "%s=%s\n", s.Key, s.Value)
+			}
+		}
+	}
+	if tmplFile != "" {
+		data, err := ioutil.ReadFile(tmplFile)
+		if err != nil {
+			return "", err
+		}
+		b.Write(data)
+	}
+	return b.String(), nil
+}
+
+// dirImportPath returns the import path of the package in dir, following the
+// module path of the nearest go.mod.
+func dirImportPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for modDir := abs; ; modDir = filepath.Dir(modDir) {
+		data, err := ioutil.ReadFile(filepath.Join(modDir, "go.mod"))
+		if err == nil {
+			modPath := genconstructor.ModulePath(data)
+			if modPath == "" {
+				return "", fmt.Errorf("no module path in %s", filepath.Join(modDir, "go.mod"))
+			}
+			rel, err := filepath.Rel(modDir, abs)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(modPath, filepath.ToSlash(rel)), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if filepath.Dir(modDir) == modDir {
+			return "", fmt.Errorf("%s is not in a module", dir)
+		}
+	}
+}
+
+// outOfDateError lists the generated files found out of date by -check.
+type outOfDateError struct {
+	paths []string
+}
+
+func (e outOfDateError) Error() string {
+	return "generated files are out of date, run go-genconstructor:\n\t" + strings.Join(e.paths, "\n\t")
+}
+
+// checkFiles returns an outOfDateError if a file of generated, the contents
+// generated by path, is missing or differs, or exists when its contents are
+// nil, being stale.
+func checkFiles(generated map[string]*bytes.Buffer) error {
+	var paths []string
+	for path, b := range generated {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if b == nil {
+			if err == nil {
+				paths = append(paths, path)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(data, b.Bytes()) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	sort.Strings(paths)
+	return outOfDateError{paths: paths}
+}
+
+// printFiles writes the contents of the files of generated into w in the
+// order of their paths, each after a comment naming its path if there are
+// several of them, so that a single file can be piped as is.
+func printFiles(w io.Writer, generated map[string]*bytes.Buffer) error {
+	paths := make([]string, 0, len(generated))
+	for path, b := range generated {
+		if b != nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for i, path := range paths {
+		if len(paths) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "// %s\n", path)
+		}
+		if _, err := w.Write(generated[path].Bytes()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// listFiles writes the paths of the files of generated into w, those which
+// would be written, and prefixed with "remove " those stale files which
+// would be removed.
+func listFiles(w io.Writer, generated map[string]*bytes.Buffer) error {
+	paths := make([]string, 0, len(generated))
+	for path := range generated {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if generated[path] != nil {
+			fmt.Fprintln(w, path)
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			fmt.Fprintln(w, "remove "+path)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// generatedComment is the comment marking generated files, as go generate
+// documents it, before packageClause.
+var (
+	generatedComment = regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`)
+	packageClause    = regexp.MustCompile(`(?m)^package `)
+)
+
+// staleConstraintFiles returns the files matching pattern but those of
+// keep which were generated apart for constrained files: those marked as
+// generated, and those named after a source file of sources, such as
+// foo_linux_constructor_gen.go, which -no-header writes unmarked.
+func staleConstraintFiles(pattern string, keep map[string]bool, sources []string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	named := make(map[string]bool, len(sources))
+	for _, path := range sources {
+		named[path] = true
+	}
+	var stale []string
+	for _, path := range matches {
+		if keep[path] {
+			continue
+		}
+		if !named[path] {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			// the comment precedes the package clause
+			if loc := packageClause.FindIndex(data); loc != nil {
+				data = data[:loc[0]]
+			}
+			if !generatedComment.Match(data) {
+				continue
+			}
+		}
+		stale = append(stale, path)
+	}
+	return stale, nil
+}
+
+// createFile returns the writer of path, which is replaced only once the
+// writer is closed after a successful write, keeping the mode of an existing
+// file. With force, an existing read-only file is made writable.
+func createFile(path string, force bool) (*atomicFile, error) {
+	mode := os.FileMode(0644)
+	if finfo, err := os.Stat(path); err == nil {
+		mode = finfo.Mode().Perm()
+		if mode&0200 == 0 {
+			if !force {
+				err := &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+				return nil, fmt.Errorf("%v (use -force to overwrite read-only files)", err)
+			}
+			mode |= 0200
+		}
+	}
+	// the name starting with a dot is ignored by the go command if the
+	// file is left behind
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+// atomicFile is a temporary file renamed over path when it is closed, so
+// that a failed or interrupted run never leaves path half written. It is
+// removed instead if nothing was written or a write failed.
+type atomicFile struct {
+	*os.File
+	path    string
+	written bool
+	err     error
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if err != nil {
+		f.err = err
+	} else {
+		f.written = true
+	}
+	return n, err
+}
+
+func (f *atomicFile) Close() error {
+	err := f.File.Close()
+	if err != nil || f.err != nil || !f.written {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), f.path)
+}
+
+// errWriter reports err on every write, so that failing to open the output
+// surfaces as the error of genconstructor.Run.
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
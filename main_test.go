@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range map[string]string{
+		"go.mod": "module example.com/a\n",
+		"a.go": `package a
+
+type FooDTO struct {
+	key string
+}
+
+//genconstructor -unexported -from=FooDTO
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Main([]string{"go-genconstructor", "-prefix", "zz_generated.", "-usage-guards", dir}); err != nil {
+		t.Fatal(err)
+	}
+	// the prefix names the file only, not the constructors
+	data, err := ioutil.ReadFile(filepath.Join(dir, "zz_generated.a_constructor_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"func newFoo(\n",
+		"func newFooFromFooDTO(fooDTO FooDTO) Foo {\n\treturn newFoo(fooDTO.key)\n}\n",
+		"var (\n\t_ = newFoo\n\t_ = newFooFromFooDTO\n)\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("got:\n%s\nwant:\n%s", data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a_constructor_gen.go")); !os.IsNotExist(err) {
+		t.Errorf("got %v, want a_constructor_gen.go not written", err)
+	}
+}
+
+func TestStaleConstraintFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	header := "// Code generated by go-genconstructor; DO NOT EDIT.\n\npackage a\n"
+	for name, src := range map[string]string{
+		"a_constructor_gen.go": header,
+		// written apart by this run
+		"foo_linux_constructor_gen.go": header,
+		// written apart by an earlier run
+		"foo_windows_constructor_gen.go": header,
+		// by an earlier run with -no-header, for a file of the package
+		"bar_constructor_gen.go": "package a\n",
+		// not generated
+		"baz_constructor_gen.go": "package a\n\n// Code generated by hand; DO NOT EDIT.\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keep := map[string]bool{
+		filepath.Join(dir, "a_constructor_gen.go"):         true,
+		filepath.Join(dir, "foo_linux_constructor_gen.go"): true,
+	}
+	sources := []string{
+		filepath.Join(dir, "a_constructor_gen.go"),
+		filepath.Join(dir, "bar_constructor_gen.go"),
+		filepath.Join(dir, "foo_linux_constructor_gen.go"),
+	}
+	got, err := staleConstraintFiles(filepath.Join(dir, "*_constructor_gen.go"), keep, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "bar_constructor_gen.go"),
+		filepath.Join(dir, "foo_windows_constructor_gen.go"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	for _, tt := range []struct {
+		name       string
+		err        error
+		want       int
+		wantLogged bool
+	}{
+		{name: "success", want: exitOK},
+		{name: "-help", err: flag.ErrHelp, want: exitOK},
+		{name: "usage", err: usageError{err: errors.New("-jobs must be positive")}, want: exitError},
+		{name: "failure", err: errors.New("no such directory"), want: exitError, wantLogged: true},
+		{name: "out of date", err: outOfDateError{paths: []string{"a_constructor_gen.go"}}, want: exitOutOfDate, wantLogged: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			logged.Reset()
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+			if got := logged.Len() > 0; got != tt.wantLogged {
+				t.Errorf("got logged %q, want logged %t", logged.String(), tt.wantLogged)
+			}
+		})
+	}
+}
+
+func TestCheckFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range map[string]string{
+		"same.go":    "package a\n",
+		"differs.go": "package a\n",
+		"stale.go":   "package a\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing, same, differs, stale := filepath.Join(dir, "missing.go"), filepath.Join(dir, "same.go"), filepath.Join(dir, "differs.go"), filepath.Join(dir, "stale.go")
+
+	err = checkFiles(map[string]*bytes.Buffer{
+		missing: bytes.NewBufferString("package a\n"),
+		same:    bytes.NewBufferString("package a\n"),
+		differs: bytes.NewBufferString("package b\n"),
+		stale:   nil,
+		// neither generated nor there
+		filepath.Join(dir, "gone.go"): nil,
+	})
+	var outOfDate outOfDateError
+	if !errors.As(err, &outOfDate) {
+		t.Fatalf("got %v, want an outOfDateError", err)
+	}
+	if want := []string{differs, missing, stale}; !reflect.DeepEqual(outOfDate.paths, want) {
+		t.Errorf("got paths %q, want %q", outOfDate.paths, want)
+	}
+	if want := "generated files are out of date, run go-genconstructor:\n\t" + differs; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("got %q, want prefix %q", err, want)
+	}
+
+	// -check fails with exit status 2 for out of date files only
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	if code := exitCode(err); code != exitOutOfDate {
+		t.Errorf("got exit code %d, want %d", code, exitOutOfDate)
+	}
+	if code := exitCode(fmt.Errorf("generating: %w", err)); code != exitOutOfDate {
+		t.Errorf("got exit code %d for a wrapped error, want %d", code, exitOutOfDate)
+	}
+
+	if err := checkFiles(map[string]*bytes.Buffer{same: bytes.NewBufferString("package a\n")}); err != nil {
+		t.Errorf("got %v, want nil for up to date files", err)
+	}
+	if err := checkFiles(map[string]*bytes.Buffer{filepath.Join(same, "a.go"): nil}); err == nil || errors.As(err, &outOfDate) {
+		t.Errorf("got %v, want the error reading the file", err)
+	}
+}
+
+func TestPrintFiles(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		generated map[string]*bytes.Buffer
+		want      string
+	}{
+		{
+			name: "single file",
+			generated: map[string]*bytes.Buffer{
+				"a_constructor_gen.go": bytes.NewBufferString("package a\n"),
+				// stale
+				"b_constructor_gen.go": nil,
+			},
+			want: "package a\n",
+		},
+		{
+			name: "files",
+			generated: map[string]*bytes.Buffer{
+				"b/b_constructor_gen.go": bytes.NewBufferString("package b\n"),
+				"a/a_constructor_gen.go": bytes.NewBufferString("package a\n"),
+			},
+			want: "// a/a_constructor_gen.go\npackage a\n\n// b/b_constructor_gen.go\npackage b\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := printFiles(&out, tt.generated); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stale := filepath.Join(dir, "b_constructor_gen.go")
+	if err := ioutil.WriteFile(stale, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	written := filepath.Join(dir, "a_constructor_gen.go")
+
+	var out strings.Builder
+	err = listFiles(&out, map[string]*bytes.Buffer{
+		stale:   nil,
+		written: bytes.NewBufferString("package a\n"),
+		// stale but already gone
+		filepath.Join(dir, "c_constructor_gen.go"): nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := written + "\nremove " + stale + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a_constructor_gen.go")
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// assertFile checks that path holds contents with mode, and that no
+	// temporary file is left
+	assertFile := func(contents string, mode os.FileMode) {
+		t.Helper()
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Errorf("got %q, want %q", data, contents)
+		}
+		finfo, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if finfo.Mode().Perm() != mode {
+			t.Errorf("got mode %v, want %v", finfo.Mode().Perm(), mode)
+		}
+		finfos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(finfos) != 1 {
+			t.Errorf("got %d files, want %s only", len(finfos), path)
+		}
+	}
+
+	f, err := createFile(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	// replaced only once closed
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "old\n" {
+		t.Errorf("got %q and %v before Close, want %q", data, err, "old\n")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile("new\n", 0600)
+
+	// nothing written
+	if f, err = createFile(path, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile("new\n", 0600)
+
+	if err := os.Chmod(path, 0400); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createFile(path, false); err == nil || !strings.Contains(err.Error(), "use -force") {
+		t.Errorf("got %v, want an error suggesting -force", err)
+	}
+	assertFile("new\n", 0400)
+	if f, err = createFile(path, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("forced\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile("forced\n", 0600)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GuiltyMorishita/go-genconstructor/genconstructor"
+)
+
+// serveRequest is a request of -serve: the source files of a package, by
+// file name, to generate the constructors of, and its import path, which
+// is servePkgPath unless given.
+type serveRequest struct {
+	ID      json.RawMessage   `json:"id,omitempty"`
+	Files   map[string]string `json:"files"`
+	PkgPath string            `json:"pkgPath,omitempty"`
+	Options serveOptions      `json:"options"`
+}
+
+// servePkgPath is the import path of the package of a request without one,
+// as go/build names packages given as files.
+const servePkgPath = "command-line-arguments"
+
+type serveOptions struct {
+	BuildTag string `json:"buildTag,omitempty"`
+	NoHeader bool   `json:"noHeader,omitempty"`
+	TagKey   string `json:"tagKey,omitempty"`
+	Hook     string `json:"hook,omitempty"`
+	HookType string `json:"hookType,omitempty"`
+
+	SingleLineParams int    `json:"singleLineParams,omitempty"`
+	GroupParams      bool   `json:"groupParams,omitempty"`
+	DI               string `json:"di,omitempty"`
+}
+
+// serveResponse is the response to a serveRequest with the same id: the
+// generated files by file name, or the problems found.
+type serveResponse struct {
+	ID          json.RawMessage   `json:"id,omitempty"`
+	Files       map[string]string `json:"files,omitempty"`
+	Diagnostics []serveDiagnostic `json:"diagnostics,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+type serveDiagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// serve reads newline-delimited JSON requests from r and writes a response
+// for each to w until r is exhausted.
+func serve(r io.Reader, w io.Writer, prefix string) error {
+	dec := json.NewDecoder(r)
+	enc := json.NewEncoder(w)
+	for {
+		var req serveRequest
+		if err := dec.Decode(&req); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := enc.Encode(handleServeRequest(req, prefix)); err != nil {
+			return err
+		}
+	}
+}
+
+func handleServeRequest(req serveRequest, prefix string) serveResponse {
+	res := serveResponse{ID: req.ID}
+	pkgPath := req.PkgPath
+	if pkgPath == "" {
+		pkgPath = servePkgPath
+	}
+	files, diags, err := generateFromFiles(req.Files, pkgPath, req.Options, prefix)
+	res.Files = files
+	res.Diagnostics = diags
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// generateFromFiles generates the constructors of the package pkgPath made
+// of files in a scratch directory, since the parser reads packages from
+// directories.
+func generateFromFiles(files map[string]string, pkgPath string, options serveOptions, prefix string) (map[string]string, []serveDiagnostic, error) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	for name, src := range files {
+		if name != filepath.Base(name) || !strings.HasSuffix(name, ".go") {
+			return nil, nil, fmt.Errorf("invalid file name %q", name)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var diags []serveDiagnostic
+	opts := []genconstructor.Option{
+		genconstructor.WithPackagePath(pkgPath),
+		genconstructor.WithFileFilter(
+			func(finfo os.FileInfo) bool {
+				return !strings.HasSuffix(finfo.Name(), "_test.go")
+			},
+		),
+		genconstructor.WithDiagnosticsSink(func(d genconstructor.Diagnostic) {
+			diags = append(diags, serveDiagnostic{
+				File:     filepath.Base(d.Pos.Filename),
+				Line:     d.Pos.Line,
+				Column:   d.Pos.Column,
+				Severity: d.Severity.String(),
+				Message:  d.Message,
+			})
+		}),
+	}
+	if options.BuildTag != "" {
+		opts = append(opts, genconstructor.WithBuildTag(options.BuildTag))
+	}
+	if options.NoHeader {
+		opts = append(opts, genconstructor.WithoutHeader())
+	}
+	if options.TagKey != "" {
+		opts = append(opts, genconstructor.WithTagKey(options.TagKey))
+	}
+	if options.SingleLineParams > 0 {
+		opts = append(opts, genconstructor.WithSingleLineParams(options.SingleLineParams))
+	}
+	if options.GroupParams {
+		opts = append(opts, genconstructor.WithGroupedParams())
+	}
+	if options.DI != "" {
+		opts = append(opts, genconstructor.WithDI(options.DI))
+	}
+	if options.Hook != "" {
+		opts = append(opts, genconstructor.WithHook(options.Hook, options.HookType))
+	}
+
+	outputs := make(map[string]*bytes.Buffer)
+	err = genconstructor.Run(
+		dir,
+		func(pkg *ast.Package) io.Writer {
+			buf := new(bytes.Buffer)
+			outputs[fmt.Sprintf("%s%s_constructor_gen.go", prefix, pkg.Name)] = buf
+			return buf
+		},
+		opts...,
+	)
+	if _, ok := err.(genconstructor.Diagnostics); ok {
+		// already reported to the sink
+		err = nil
+	}
+
+	generated := make(map[string]string, len(outputs))
+	for name, buf := range outputs {
+		generated[name] = buf.String()
+	}
+	return generated, diags, err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	req, err := json.Marshal(serveRequest{
+		ID: json.RawMessage("1"),
+		Files: map[string]string{
+			"a.go": `package a
+
+//genconstructor
+type Foo struct {
+	key string ` + "`required:\"\"`" + `
+}
+`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := serve(bytes.NewReader(append(req, '\n')), &out, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var res serveResponse
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != "" {
+		t.Fatalf("error %q", res.Error)
+	}
+	if string(res.ID) != "1" {
+		t.Errorf("got id %s, want 1", res.ID)
+	}
+	got, ok := res.Files["a_constructor_gen.go"]
+	if !ok || len(res.Files) != 1 {
+		t.Fatalf("got files %v, want a_constructor_gen.go", res.Files)
+	}
+	want := `func NewFoo(
+	key string,
+) Foo {
+	return Foo{
+		key: key,
+	}
+}
+`
+	if !strings.HasPrefix(got, "// Code generated by go-genconstructor; DO NOT EDIT.") || !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", got, want)
+	}
+}
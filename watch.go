@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GuiltyMorishita/go-genconstructor/genconstructor"
+)
+
+// watchInterval is how often -watch looks for changed files.
+const watchInterval = 500 * time.Millisecond
+
+// fileStamp is what tells that a file changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watch calls generate, and then again each time one of the files below the
+// directory of targetDir, out of the directories matching one of excluded,
+// which watched accepts is added, changed or removed.
+// The errors of generate are logged, and watch only returns when the files
+// cannot be listed.
+func watch(targetDir string, excluded []string, watched func(path string) bool, generate func() error) error {
+	var prev map[string]fileStamp
+	for {
+		// the files are listed before generating, so that the changes
+		// saved while generating are not missed
+		stamps, err := watchedFiles(targetDir, excluded, watched)
+		if err != nil {
+			return err
+		}
+		if !sameStamps(stamps, prev) {
+			if prev != nil {
+				log.Print("regenerating")
+			}
+			if err := generate(); err != nil {
+				log.Print(err)
+			}
+			prev = stamps
+		}
+		time.Sleep(watchInterval)
+	}
+}
+
+// watchedFiles returns the stamps of the files of targetDir, or of the
+// directories below the root of a pattern such as ./... but those matching
+// one of excluded, which watched accepts.
+func watchedFiles(targetDir string, excluded []string, watched func(path string) bool) (map[string]fileStamp, error) {
+	root := patternDir(targetDir)
+	recursive := strings.HasSuffix(filepath.ToSlash(targetDir), "...")
+	stamps := make(map[string]fileStamp)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path != root {
+				// removed while listing
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path == root {
+				return nil
+			}
+			name := info.Name()
+			if !recursive || name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			matched, err := genconstructor.ExcludedDir(rel, excluded)
+			if err != nil {
+				return err
+			}
+			if matched {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if watched(path) {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	return stamps, err
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		if o, ok := b[path]; !ok || !o.modTime.Equal(stamp.modTime) || o.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{
+		"a.go",
+		"a_constructor_gen.go",
+		"README.md",
+		"b/b.go",
+		"b/mocks/mock.go",
+		"c/c.go",
+		"c/legacy/legacy.go",
+		"d/legacy/legacy.go",
+		"vendor/v/v.go",
+		"_tools/tools.go",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("package a\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	watched := func(path string) bool {
+		return strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_constructor_gen.go")
+	}
+
+	for _, tt := range []struct {
+		name      string
+		targetDir string
+		excluded  []string
+		want      []string
+	}{
+		{
+			name:      "directory",
+			targetDir: dir,
+			want:      []string{"a.go"},
+		},
+		{
+			name:      "tree",
+			targetDir: dir + "/...",
+			want:      []string{"a.go", "b/b.go", "b/mocks/mock.go", "c/c.go", "c/legacy/legacy.go", "d/legacy/legacy.go"},
+		},
+		{
+			name:      "excluded",
+			targetDir: dir + "/...",
+			excluded:  []string{"mocks", "c/legacy"},
+			want:      []string{"a.go", "b/b.go", "c/c.go", "d/legacy/legacy.go"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			stamps, err := watchedFiles(tt.targetDir, tt.excluded, watched)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for path := range stamps {
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(rel))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameStamps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genconstructor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	if err := ioutil.WriteFile(a, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	watched := func(path string) bool { return true }
+	stamps := func() map[string]fileStamp {
+		t.Helper()
+		stamps, err := watchedFiles(dir, nil, watched)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stamps
+	}
+
+	prev := stamps()
+	if !sameStamps(stamps(), prev) {
+		t.Error("got a change, want none")
+	}
+
+	// changed in size
+	if err := ioutil.WriteFile(a, []byte("package a // x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if next := stamps(); sameStamps(next, prev) {
+		t.Error("got no change, want the size of a.go changed")
+	} else {
+		prev = next
+	}
+
+	// changed in time only
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(a, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if next := stamps(); sameStamps(next, prev) {
+		t.Error("got no change, want the time of a.go changed")
+	} else {
+		prev = next
+	}
+
+	// added
+	if err := ioutil.WriteFile(b, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if next := stamps(); sameStamps(next, prev) {
+		t.Error("got no change, want b.go added")
+	} else {
+		prev = next
+	}
+
+	// removed
+	if err := os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	if sameStamps(stamps(), prev) {
+		t.Error("got no change, want b.go removed")
+	}
+}